@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type actorKey struct{}
+
+// adminActor returns the name of the admin that made a request
+func adminActor(r *http.Request) string {
+	actor, _ := r.Context().Value(actorKey{}).(string)
+	return actor
+}
+
+// adminTokens returns the admin tokens by name. AdminToken is named "admin".
+func (conf *Config) adminTokens() map[string]string {
+	tokens := make(map[string]string, len(conf.Global.Admins)+1)
+	for name, token := range conf.Global.Admins {
+		if token != "" {
+			tokens[name] = token
+		}
+	}
+	if conf.Global.AdminToken != "" {
+		tokens["admin"] = conf.Global.AdminToken
+	}
+	return tokens
+}
+
+// requireAdmin only lets requests with an admin bearer token through, and a
+// client certificate if TLS.ClientCA is set. The admin API is disabled when
+// no token is configured.
+func (fh *FormHandler) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokens := fh.Config.adminTokens()
+		if len(tokens) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		if fh.Config.Global.TLS.ClientCA != "" && !hasClientCert(r) {
+			http.Error(w, "Client certificate required", http.StatusForbidden)
+			return
+		}
+		given, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		actor := ""
+		for name, token := range tokens {
+			if subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+				actor = name
+			}
+		}
+		if !found || actor == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), actorKey{}, actor)))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleTrain trains the classifier with a text, e.g. {"text": "...", "spam": true}
+func (fh *FormHandler) handleTrain(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text string `json:"text"`
+		Spam bool   `json:"spam"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Text == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if err := fh.train(req.Text, req.Spam); err != nil {
+		slog.Error("Failed to train classifier:", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	spam, ham := fh.Classifier.Trained()
+	writeJSON(w, http.StatusOK, map[string]int{"spam": spam, "ham": ham})
+}
+
+// handleListQuarantine lists the quarantined submissions of a form
+func (fh *FormHandler) handleListQuarantine(w http.ResponseWriter, r *http.Request) {
+	ids, err := fh.Quarantine.List(r.PathValue("form"))
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, ids)
+}
+
+// handleGetQuarantine returns a quarantined submission
+func (fh *FormHandler) handleGetQuarantine(w http.ResponseWriter, r *http.Request) {
+	record, err := fh.Quarantine.Load(r.PathValue("form"), r.PathValue("sid"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, record)
+}
+
+// handleMarkQuarantine marks a quarantined submission as spam or ham.
+// Spam is discarded, ham is delivered. Either way the classifier and IP
+// reputation learn from it.
+func (fh *FormHandler) handleMarkQuarantine(w http.ResponseWriter, r *http.Request) {
+	form, sid, verdict := r.PathValue("form"), r.PathValue("sid"), r.PathValue("verdict")
+	if verdict != "spam" && verdict != "ham" {
+		http.NotFound(w, r)
+		return
+	}
+	record, err := fh.Quarantine.Load(form, sid)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	formCfg := fh.Config.Forms[record.Form]
+
+	if verdict == "ham" {
+		sub := FormSubmission{
+			Id:        record.Form,
+			Body:      record.Body,
+			FormCfg:   formCfg,
+			UserAgent: record.UserAgent,
+			UserIP:    record.UserIP,
+			Referrer:  record.Referrer,
+			Country:   record.Country,
+		}
+		if err := fh.sendMail(sub); err != nil {
+			http.Error(w, "Failed to deliver submission", http.StatusBadGateway)
+			return
+		}
+	}
+	fh.applyFeedback(record, verdict == "spam", adminActor(r))
+	if err := fh.Quarantine.Delete(form, sid); err != nil && !os.IsNotExist(err) {
+		slog.Error("Failed to delete quarantined submission:", slog.Any("error", err))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleMarkDelivered marks a delivered submission as spam or ham, like the
+// feedback links in its email
+func (fh *FormHandler) handleMarkDelivered(w http.ResponseWriter, r *http.Request) {
+	form, sid, verdict := r.PathValue("form"), r.PathValue("sid"), r.PathValue("verdict")
+	if fh.Delivered == nil || (verdict != "spam" && verdict != "ham") {
+		http.NotFound(w, r)
+		return
+	}
+	record, err := fh.Delivered.Take(form, sid)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	fh.applyFeedback(record, verdict == "spam", adminActor(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListBlocklist returns the terms in the blocklist file
+func (fh *FormHandler) handleListBlocklist(w http.ResponseWriter, r *http.Request) {
+	if fh.BlocklistFile == nil {
+		http.NotFound(w, r)
+		return
+	}
+	terms := fh.BlocklistFile.Get()
+	if terms == nil {
+		terms = []string{}
+	}
+	writeJSON(w, http.StatusOK, terms)
+}
+
+// serializes edits of the blocklist file
+var blocklistFileMu sync.Mutex
+
+// handleEditBlocklist adds (POST) or removes (DELETE) a blocklist term,
+// e.g. {"term": "word:casino"}
+func (fh *FormHandler) handleEditBlocklist(w http.ResponseWriter, r *http.Request) {
+	if fh.BlocklistFile == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var req struct {
+		Term string `json:"term"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	term := strings.TrimSpace(req.Term)
+	if term == "" || strings.HasPrefix(term, "#") || strings.ContainsAny(term, "\r\n") {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	blocklistFileMu.Lock()
+	defer blocklistFileMu.Unlock()
+	path := fh.Config.Global.BlocklistFile
+	var changed bool
+	var err error
+	if r.Method == http.MethodDelete {
+		changed, err = removeLine(path, term)
+	} else if !slices.Contains(fh.BlocklistFile.Get(), term) {
+		changed, err = true, appendLine(path, term)
+	}
+	if err != nil {
+		slog.Error("Failed to update blocklist:", slog.Any("error", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodDelete && !changed {
+		http.NotFound(w, r)
+		return
+	}
+	if changed {
+		fh.BlocklistFile.Reload()
+		slog.Info("Blocklist updated:",
+			slog.String("method", r.Method),
+			slog.String("term", term),
+			slog.String("actor", adminActor(r)),
+		)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
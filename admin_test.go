@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lkhrs/fohago/antispam"
+)
+
+func newAdminTestHandler(t *testing.T) (*FormHandler, *http.ServeMux) {
+	conf := &Config{Forms: map[string]FormConfig{"contact": {}}}
+	conf.Global.AdminToken = "admin"
+	conf.Global.Bayes.File = filepath.Join(t.TempDir(), "bayes.json")
+	fh := &FormHandler{
+		Config:     conf,
+		Quarantine: &Quarantine{Dir: t.TempDir()},
+		Classifier: antispam.NewClassifier(),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /admin/train", fh.requireAdmin(fh.handleTrain))
+	mux.HandleFunc("GET /admin/quarantine/{form}", fh.requireAdmin(fh.handleListQuarantine))
+	mux.HandleFunc("POST /admin/quarantine/{form}/{sid}/{verdict}", fh.requireAdmin(fh.handleMarkQuarantine))
+	return fh, mux
+}
+
+func adminRequest(mux *http.ServeMux, method, target, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+func TestFormHandler_requireAdmin(t *testing.T) {
+	fh, mux := newAdminTestHandler(t)
+
+	if w := adminRequest(mux, "GET", "/admin/quarantine/contact", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %v without token, got %v", http.StatusUnauthorized, w.Code)
+	}
+	if w := adminRequest(mux, "GET", "/admin/quarantine/contact", "wrong", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %v with wrong token, got %v", http.StatusUnauthorized, w.Code)
+	}
+	if w := adminRequest(mux, "GET", "/admin/quarantine/contact", "admin", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected %v, got %v", http.StatusOK, w.Code)
+	}
+
+	fh.Config.Global.AdminToken = ""
+	if w := adminRequest(mux, "GET", "/admin/quarantine/contact", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected %v when disabled, got %v", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestFormHandler_handleTrain(t *testing.T) {
+	fh, mux := newAdminTestHandler(t)
+
+	if w := adminRequest(mux, "POST", "/admin/train", "admin", `{"text": "buy cheap seo", "spam": true}`); w.Code != http.StatusOK {
+		t.Errorf("Expected %v, got %v", http.StatusOK, w.Code)
+	}
+	if w := adminRequest(mux, "POST", "/admin/train", "admin", `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected %v, got %v", http.StatusBadRequest, w.Code)
+	}
+	if spam, ham := fh.Classifier.Trained(); spam != 1 || ham != 0 {
+		t.Errorf("Expected 1 spam and 0 ham, got %v and %v", spam, ham)
+	}
+}
+
+func TestFormHandler_handleMarkQuarantine(t *testing.T) {
+	fh, mux := newAdminTestHandler(t)
+	sid, err := fh.Quarantine.Store(FormSubmission{Id: "contact", Body: FormBody{"message": "cheap seo"}}, SpamResult{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if w := adminRequest(mux, "POST", "/admin/quarantine/contact/"+sid+"/maybe", "admin", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected %v for unknown verdict, got %v", http.StatusNotFound, w.Code)
+	}
+	if w := adminRequest(mux, "POST", "/admin/quarantine/contact/"+sid+"/spam", "admin", ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected %v, got %v", http.StatusNoContent, w.Code)
+	}
+	if spam, _ := fh.Classifier.Trained(); spam != 1 {
+		t.Errorf("Expected 1 spam, got %v", spam)
+	}
+	if ids, _ := fh.Quarantine.List("contact"); len(ids) != 0 {
+		t.Errorf("Expected quarantine to be empty, got %v", ids)
+	}
+	if w := adminRequest(mux, "POST", "/admin/quarantine/contact/"+sid+"/spam", "admin", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected %v once removed, got %v", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestFormHandler_requireAdminActor(t *testing.T) {
+	fh, _ := newAdminTestHandler(t)
+	fh.Config.Global.Admins = map[string]string{"alice": "alice-token"}
+	actor := ""
+	handler := fh.requireAdmin(func(w http.ResponseWriter, r *http.Request) {
+		actor = adminActor(r)
+	})
+
+	for token, expected := range map[string]string{"alice-token": "alice", "admin": "admin"} {
+		r := httptest.NewRequest("GET", "/admin/blocklist", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected %v, got %v", http.StatusOK, w.Code)
+		}
+		if actor != expected {
+			t.Errorf("Expected actor %q, got %q", expected, actor)
+		}
+	}
+}
+
+func TestFormHandler_handleEditBlocklist(t *testing.T) {
+	fh, mux := newAdminTestHandler(t)
+	fh.Config.Global.BlocklistFile = filepath.Join(t.TempDir(), "blocklist.txt")
+	fh.BlocklistFile = newBlocklistFile(fh.Config.Global.BlocklistFile)
+	mux.HandleFunc("GET /admin/blocklist", fh.requireAdmin(fh.handleListBlocklist))
+	mux.HandleFunc("POST /admin/blocklist", fh.requireAdmin(fh.handleEditBlocklist))
+	mux.HandleFunc("DELETE /admin/blocklist", fh.requireAdmin(fh.handleEditBlocklist))
+
+	for _, term := range []string{"casino", "word:seo", "casino"} {
+		if w := adminRequest(mux, "POST", "/admin/blocklist", "admin", `{"term": "`+term+`"}`); w.Code != http.StatusNoContent {
+			t.Errorf("Expected %v, got %v", http.StatusNoContent, w.Code)
+		}
+	}
+	if w := adminRequest(mux, "POST", "/admin/blocklist", "admin", `{"term": "a\nb"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected %v for a term with a newline, got %v", http.StatusBadRequest, w.Code)
+	}
+	if w := adminRequest(mux, "GET", "/admin/blocklist", "admin", ""); w.Body.String() != "[\"casino\",\"word:seo\"]\n" {
+		t.Errorf("Expected both terms once, got %v", w.Body.String())
+	}
+
+	sub := FormSubmission{Id: "contact", Body: FormBody{"message": "Best casino"}}
+	sub.FormCfg.Fields.Message = "message"
+	c := &Check{}
+	if pass, _ := c.blocklist(sub, *fh); pass {
+		t.Error("Expected the added term to be blocked")
+	}
+
+	if w := adminRequest(mux, "DELETE", "/admin/blocklist", "admin", `{"term": "casino"}`); w.Code != http.StatusNoContent {
+		t.Errorf("Expected %v, got %v", http.StatusNoContent, w.Code)
+	}
+	if w := adminRequest(mux, "DELETE", "/admin/blocklist", "admin", `{"term": "casino"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected %v once removed, got %v", http.StatusNotFound, w.Code)
+	}
+	if pass, err := c.blocklist(sub, *fh); !pass {
+		t.Errorf("Expected the removed term to pass, got %v", err)
+	}
+	if _, cached := matcherCache.Load(matchSubstring + "\x00casino"); cached {
+		t.Error("Expected the removed term not to stay cached")
+	}
+}
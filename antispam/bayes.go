@@ -0,0 +1,179 @@
+package antispam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	// number of tokens with the strongest evidence used to classify a text
+	interestingTokens = 15
+	// Robinson's smoothing: weight and probability assumed for rare tokens
+	tokenStrength    = 1.0
+	tokenAssumedProb = 0.5
+)
+
+/*
+Classifier is a naive Bayes spam classifier that learns from texts marked
+as spam or ham. Token counts are kept per class and can be saved as JSON.
+
+https://www.paulgraham.com/spam.html
+*/
+type Classifier struct {
+	mu       sync.RWMutex
+	Spam     map[string]int `json:"spam"`
+	Ham      map[string]int `json:"ham"`
+	SpamDocs int            `json:"spamDocs"`
+	HamDocs  int            `json:"hamDocs"`
+}
+
+func NewClassifier() *Classifier {
+	return &Classifier{
+		Spam: make(map[string]int),
+		Ham:  make(map[string]int),
+	}
+}
+
+// LoadClassifier reads a classifier saved with Save. A missing file returns
+// an empty classifier along with the error, a corrupt one returns nil so it
+// isn't saved over.
+func LoadClassifier(path string) (*Classifier, error) {
+	c := NewClassifier()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Save writes the token counts to a file. The file is replaced in one step
+// but not merged, the last classifier saved wins.
+func (c *Classifier) Save(path string) error {
+	c.mu.RLock()
+	data, err := json.Marshal(c)
+	c.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Train adds a text to the spam or ham counts
+func (c *Classifier) Train(text string, spam bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := c.Ham
+	if spam {
+		counts = c.Spam
+		c.SpamDocs++
+	} else {
+		c.HamDocs++
+	}
+	for _, token := range tokenize(text) {
+		counts[token]++
+	}
+}
+
+// Trained returns the number of spam and ham texts the classifier has learned from
+func (c *Classifier) Trained() (spam int, ham int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.SpamDocs, c.HamDocs
+}
+
+// Probability returns how likely a text is spam, from 0 to 1.
+// An untrained classifier returns 0.5.
+func (c *Classifier) Probability(text string) float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.SpamDocs == 0 || c.HamDocs == 0 {
+		return tokenAssumedProb
+	}
+
+	var probs []float64
+	for _, token := range tokenize(text) {
+		probs = append(probs, c.tokenProbability(token))
+	}
+	// use the tokens that are furthest from neutral
+	sort.Slice(probs, func(i, j int) bool {
+		return math.Abs(probs[i]-0.5) > math.Abs(probs[j]-0.5)
+	})
+	if len(probs) > interestingTokens {
+		probs = probs[:interestingTokens]
+	}
+
+	// combine in log space to avoid underflow
+	var logSpam, logHam float64
+	for _, p := range probs {
+		logSpam += math.Log(p)
+		logHam += math.Log(1 - p)
+	}
+	return 1 / (1 + math.Exp(logHam-logSpam))
+}
+
+// tokenProbability returns the smoothed probability that a text containing the token is spam
+func (c *Classifier) tokenProbability(token string) float64 {
+	spam := float64(c.Spam[token])
+	ham := float64(c.Ham[token])
+	n := spam + ham
+	if n == 0 {
+		return tokenAssumedProb
+	}
+	spamFreq := spam / float64(c.SpamDocs)
+	hamFreq := ham / float64(c.HamDocs)
+	p := spamFreq / (spamFreq + hamFreq)
+	p = (tokenStrength*tokenAssumedProb + n*p) / (tokenStrength + n)
+	// keep away from 0 and 1 so a single token can't decide
+	return math.Min(math.Max(p, 0.01), 0.99)
+}
+
+// tokenize splits a text into unique lowercase words. URLs and email
+// addresses are kept whole since they are strong spam indicators.
+func tokenize(text string) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, field := range strings.Fields(strings.ToLower(text)) {
+		words := []string{field}
+		if !strings.Contains(field, "://") && !strings.Contains(field, "@") {
+			words = strings.FieldsFunc(field, func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' && r != '$'
+			})
+		}
+		for _, word := range words {
+			word = strings.Trim(word, ".,;:!?()[]<>\"'")
+			if len(word) < 2 || len(word) > 64 || seen[word] {
+				continue
+			}
+			seen[word] = true
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
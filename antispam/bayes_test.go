@@ -0,0 +1,84 @@
+package antispam
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var spamTexts = []string{
+	"Cheap viagra pills, buy now at http://pills.example",
+	"Increase your website ranking with our SEO services, buy now",
+	"Buy cheap backlinks and SEO traffic for your website",
+	"Casino bonus, win money now, click http://casino.example",
+}
+
+var hamTexts = []string{
+	"Hi, I'd like to book a table for four on Friday evening",
+	"Could you send me a quote for repairing our garden fence?",
+	"Thanks for the quick delivery, the table looks great",
+	"Is the workshop on Friday still happening? I'd like to bring a friend",
+}
+
+func trainedClassifier() *Classifier {
+	c := NewClassifier()
+	for _, text := range spamTexts {
+		c.Train(text, true)
+	}
+	for _, text := range hamTexts {
+		c.Train(text, false)
+	}
+	return c
+}
+
+func TestClassifier_Probability(t *testing.T) {
+	if p := NewClassifier().Probability("buy cheap seo"); p != 0.5 {
+		t.Errorf("Expected untrained classifier to return 0.5, got %v", p)
+	}
+
+	c := trainedClassifier()
+	if p := c.Probability("Buy cheap SEO for your website now"); p < 0.9 {
+		t.Errorf("Expected spam probability above 0.9, got %v", p)
+	}
+	if p := c.Probability("Can I book a table for Friday?"); p > 0.1 {
+		t.Errorf("Expected ham probability below 0.1, got %v", p)
+	}
+	if spam, ham := c.Trained(); spam != 4 || ham != 4 {
+		t.Errorf("Expected 4 spam and 4 ham, got %v and %v", spam, ham)
+	}
+}
+
+func TestClassifier_Save(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bayes.json")
+	c := trainedClassifier()
+	if err := c.Save(path); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	loaded, err := LoadClassifier(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Spam, c.Spam) || !reflect.DeepEqual(loaded.Ham, c.Ham) {
+		t.Errorf("Expected loaded token counts to match")
+	}
+	if loaded.SpamDocs != c.SpamDocs || loaded.HamDocs != c.HamDocs {
+		t.Errorf("Expected loaded document counts to match")
+	}
+	if files, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*")); len(files) != 1 {
+		t.Errorf("Expected no temporary files to be left, got %v", files)
+	}
+
+	os.WriteFile(path, []byte("{corrupt"), 0o600)
+	if loaded, err := LoadClassifier(path); loaded != nil || err == nil {
+		t.Errorf("Expected nil and an error for a corrupt file, got %v", err)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := tokenize("Visit http://spam.example/x, e-mail me@spam.example! Visit a B2B site.")
+	expected := []string{"visit", "http://spam.example/x", "mail", "me@spam.example", "b2b", "site"}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("Expected %v, got %v", expected, tokens)
+	}
+}
@@ -0,0 +1,33 @@
+package antispam
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Verifier verifies the response token from a captcha widget
+type Verifier interface {
+	Verify(token string, remoteIP string) (bool, error)
+}
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// siteverify posts a form to a captcha verification endpoint and decodes the JSON response
+func siteverify(client *http.Client, endpoint string, form url.Values, v any) error {
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.PostForm(endpoint, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return errors.New("HTTP " + strconv.Itoa(resp.StatusCode))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,79 @@
+package antispam
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// siteverifyStub returns a server that checks the posted form and replies with resp
+func siteverifyStub(t *testing.T, resp map[string]any) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("Failed to parse form: %v", err)
+		}
+		if r.PostForm.Get("secret") != "secret" {
+			t.Errorf("Expected secret 'secret', got %q", r.PostForm.Get("secret"))
+		}
+		if r.PostForm.Get("response") != "token" {
+			t.Errorf("Expected response 'token', got %q", r.PostForm.Get("response"))
+		}
+		if r.PostForm.Get("remoteip") != "192.0.2.1" {
+			t.Errorf("Expected remoteip '192.0.2.1', got %q", r.PostForm.Get("remoteip"))
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHCaptcha(t *testing.T) {
+	srv := siteverifyStub(t, map[string]any{"success": true})
+	pass, err := HCaptcha{Secret: "secret", Endpoint: srv.URL}.Verify("token", "192.0.2.1")
+	if !pass || err != nil {
+		t.Errorf("Expected pass, got %v %v", pass, err)
+	}
+
+	srv = siteverifyStub(t, map[string]any{"success": false, "error-codes": []string{"invalid-input-response"}})
+	pass, err = HCaptcha{Secret: "secret", Endpoint: srv.URL}.Verify("token", "192.0.2.1")
+	if pass {
+		t.Errorf("Expected fail, got pass")
+	}
+	if err == nil || err.Error() != "invalid-input-response" {
+		t.Errorf("Expected error 'invalid-input-response', got %v", err)
+	}
+}
+
+func TestReCaptcha(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier ReCaptcha
+		resp     map[string]any
+		expected bool
+	}{
+		{"v2 success", ReCaptcha{}, map[string]any{"success": true}, true},
+		{"v2 failure", ReCaptcha{}, map[string]any{"success": false}, false},
+		{"v3 score above threshold", ReCaptcha{MinScore: 0.5}, map[string]any{"success": true, "score": 0.9}, true},
+		{"v3 score below threshold", ReCaptcha{MinScore: 0.5}, map[string]any{"success": true, "score": 0.1}, false},
+		{"v3 missing score", ReCaptcha{MinScore: 0.5}, map[string]any{"success": true}, false},
+		{"v3 action match", ReCaptcha{Action: "contact"}, map[string]any{"success": true, "action": "contact"}, true},
+		{"v3 action mismatch", ReCaptcha{Action: "contact"}, map[string]any{"success": true, "action": "login"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := siteverifyStub(t, test.resp)
+			verifier := test.verifier
+			verifier.Secret = "secret"
+			verifier.Endpoint = srv.URL
+			pass, err := verifier.Verify("token", "192.0.2.1")
+			if pass != test.expected {
+				t.Errorf("Expected %v, got %v (%v)", test.expected, pass, err)
+			}
+			if !pass && err == nil {
+				t.Errorf("Expected an error, but got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package antispam
+
+import "strings"
+
+// ErrorCode is an error code reported by a captcha verification API
+type ErrorCode string
+
+func (code ErrorCode) Error() string {
+	return string(code)
+}
+
+// Error codes returned by the verification APIs, plus the ones reported
+// when a successful response does not match the expected hostname or action
+const (
+	ErrMissingInputSecret   ErrorCode = "missing-input-secret"
+	ErrInvalidInputSecret   ErrorCode = "invalid-input-secret"
+	ErrMissingInputResponse ErrorCode = "missing-input-response"
+	ErrInvalidInputResponse ErrorCode = "invalid-input-response"
+	ErrBadRequest           ErrorCode = "bad-request"
+	ErrTimeoutOrDuplicate   ErrorCode = "timeout-or-duplicate"
+	ErrInternalError        ErrorCode = "internal-error"
+	ErrHostnameMismatch     ErrorCode = "hostname-mismatch"
+	ErrActionMismatch       ErrorCode = "action-mismatch"
+	ErrScoreTooLow          ErrorCode = "score-too-low"
+)
+
+// VerifyError is returned when a token fails verification.
+// Use errors.Is to check for a specific ErrorCode.
+type VerifyError struct {
+	Codes []ErrorCode
+}
+
+func (e *VerifyError) Error() string {
+	if len(e.Codes) == 0 {
+		return "validation failed"
+	}
+	codes := make([]string, len(e.Codes))
+	for i, code := range e.Codes {
+		codes[i] = string(code)
+	}
+	return strings.Join(codes, ", ")
+}
+
+func (e *VerifyError) Is(target error) bool {
+	code, ok := target.(ErrorCode)
+	if !ok {
+		return false
+	}
+	for _, c := range e.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyError returns an error from the error codes of a failed verification
+func verifyError(codes []string) error {
+	e := &VerifyError{Codes: make([]ErrorCode, len(codes))}
+	for i, code := range codes {
+		e.Codes[i] = ErrorCode(code)
+	}
+	return e
+}
+
+// checkResponse compares the hostname and action of a successful response to
+// the expected ones, if set
+func checkResponse(hostname, expectedHostname, action, expectedAction string) error {
+	var codes []ErrorCode
+	if expectedHostname != "" && hostname != expectedHostname {
+		codes = append(codes, ErrHostnameMismatch)
+	}
+	if expectedAction != "" && action != expectedAction {
+		codes = append(codes, ErrActionMismatch)
+	}
+	if len(codes) > 0 {
+		return &VerifyError{Codes: codes}
+	}
+	return nil
+}
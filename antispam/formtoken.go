@@ -0,0 +1,78 @@
+package antispam
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTokenMaxAge is how long a form token is accepted when no maximum is set
+const DefaultTokenMaxAge = 24 * time.Hour
+
+// FormToken issues and checks HMAC signed timestamp tokens, used to reject
+// forms that are submitted faster than a human could fill them in
+type FormToken struct {
+	Key []byte
+	// Replay rejects tokens that were already used
+	Replay *ReplayCache
+}
+
+func (ft FormToken) sign(form string, payload string) string {
+	mac := hmac.New(sha256.New, ft.Key)
+	mac.Write([]byte(form + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Issue returns a token for a form that records when it was issued
+func (ft FormToken) Issue(form string, now time.Time) (string, error) {
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	payload := strconv.FormatInt(now.UnixMilli(), 10) + "." + hex.EncodeToString(nonce)
+	return payload + "." + ft.sign(form, payload), nil
+}
+
+/*
+Check reports whether a token is valid for the form and was issued between
+min and max ago. A max of 0 uses DefaultTokenMaxAge.
+*/
+func (ft FormToken) Check(token string, form string, min time.Duration, max time.Duration, now time.Time) (bool, error) {
+	if token == "" {
+		return false, errors.New("missing form token")
+	}
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return false, errors.New("invalid form token")
+	}
+	payload, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(ft.sign(form, payload)), []byte(sig)) {
+		return false, errors.New("invalid form token")
+	}
+	issuedMilli, _, _ := strings.Cut(payload, ".")
+	ms, err := strconv.ParseInt(issuedMilli, 10, 64)
+	if err != nil {
+		return false, errors.New("invalid form token")
+	}
+	issued := time.UnixMilli(ms)
+
+	if max <= 0 {
+		max = DefaultTokenMaxAge
+	}
+	age := now.Sub(issued)
+	if age < min {
+		return false, errors.New("form submitted too fast: " + age.Round(time.Millisecond).String())
+	}
+	if age > max {
+		return false, errors.New("form token expired")
+	}
+	if ft.Replay != nil && !ft.Replay.Use(token, issued.Add(max), now) {
+		return false, errors.New("form token already used")
+	}
+	return true, nil
+}
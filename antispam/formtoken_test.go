@@ -0,0 +1,43 @@
+package antispam
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormToken(t *testing.T) {
+	ft := FormToken{Key: []byte("key"), Replay: NewReplayCache()}
+	issued := time.Now()
+	token, err := ft.Issue("contact", issued)
+	if err != nil {
+		t.Fatalf("Failed to issue token: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		form     string
+		after    time.Duration
+		expected bool
+	}{
+		{"Missing token", "", "contact", 10 * time.Second, false},
+		{"Garbage token", "garbage", "contact", 10 * time.Second, false},
+		{"Tampered token", "1" + token, "contact", 10 * time.Second, false},
+		{"Other form", token, "quote", 10 * time.Second, false},
+		{"Too fast", token, "contact", time.Second, false},
+		{"Expired", token, "contact", 2 * time.Hour, false},
+		{"Valid", token, "contact", 10 * time.Second, true},
+		{"Reused", token, "contact", 10 * time.Second, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pass, err := ft.Check(test.token, test.form, 3*time.Second, time.Hour, issued.Add(test.after))
+			if pass != test.expected {
+				t.Errorf("Expected %v, got %v (%v)", test.expected, pass, err)
+			}
+			if !pass && err == nil {
+				t.Errorf("Expected an error, but got nil")
+			}
+		})
+	}
+}
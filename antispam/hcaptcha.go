@@ -0,0 +1,60 @@
+package antispam
+
+import (
+	"net/http"
+	"net/url"
+)
+
+const hcaptchaAPI = "https://api.hcaptcha.com/siteverify"
+
+type hcaptchaResponse struct {
+	Timestamp  string   `json:"challenge_ts"`
+	Hostname   string   `json:"hostname"`
+	ErrorCodes []string `json:"error-codes"`
+	Success    bool     `json:"success"`
+}
+
+/*
+HCaptcha verifies hCaptcha response tokens.
+
+https://docs.hcaptcha.com/#verify-the-user-response-server-side
+*/
+type HCaptcha struct {
+	Secret string
+	// SiteKey optionally checks that the token was issued for the site key
+	SiteKey string
+	// Hostname optionally checks the site the token was issued on
+	Hostname string
+	// Endpoint defaults to the hCaptcha siteverify API
+	Endpoint string
+	Client   *http.Client
+}
+
+func (h HCaptcha) Verify(token string, remoteIP string) (bool, error) {
+	endpoint := h.Endpoint
+	if endpoint == "" {
+		endpoint = hcaptchaAPI
+	}
+	form := url.Values{
+		"secret":   {h.Secret},
+		"response": {token},
+	}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	if h.SiteKey != "" {
+		form.Set("sitekey", h.SiteKey)
+	}
+
+	var respData hcaptchaResponse
+	if err := siteverify(h.Client, endpoint, form, &respData); err != nil {
+		return false, err
+	}
+	if !respData.Success {
+		return false, verifyError(respData.ErrorCodes)
+	}
+	if err := checkResponse(respData.Hostname, h.Hostname, "", ""); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,165 @@
+package antispam
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	powAlgorithm = "SHA-256"
+	// DefaultDifficulty is the default upper bound of the secret number
+	DefaultDifficulty = 100000
+	// DefaultChallengeTTL is how long a challenge can be solved for
+	DefaultChallengeTTL = 20 * time.Minute
+)
+
+// Challenge is a proof-of-work challenge in the format used by ALTCHA widgets
+type Challenge struct {
+	Algorithm string `json:"algorithm"`
+	Challenge string `json:"challenge"`
+	MaxNumber int64  `json:"maxnumber"`
+	Salt      string `json:"salt"`
+	Signature string `json:"signature"`
+}
+
+// Solution is the payload submitted by the widget, base64 encoded JSON
+type Solution struct {
+	Algorithm string `json:"algorithm"`
+	Challenge string `json:"challenge"`
+	Number    int64  `json:"number"`
+	Salt      string `json:"salt"`
+	Signature string `json:"signature"`
+}
+
+/*
+ProofOfWork issues and verifies self-hosted proof-of-work challenges.
+
+The client has to find the number between 0 and MaxNumber for which
+SHA-256(salt + number) equals the challenge. The challenge is signed with
+Key, so no state is kept until a solution is used.
+
+https://altcha.org/docs/proof-of-work/
+*/
+type ProofOfWork struct {
+	Key []byte
+	// MaxNumber sets the difficulty, higher numbers take longer to solve
+	MaxNumber int64
+	// TTL is how long a challenge is valid for
+	TTL time.Duration
+	// Replay rejects solutions that were already used
+	Replay *ReplayCache
+}
+
+func (p ProofOfWork) maxNumber() int64 {
+	if p.MaxNumber <= 0 {
+		return DefaultDifficulty
+	}
+	return p.MaxNumber
+}
+
+func (p ProofOfWork) sign(challenge string) string {
+	mac := hmac.New(sha256.New, p.Key)
+	mac.Write([]byte(challenge))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func hashSolution(salt string, number int64) string {
+	sum := sha256.Sum256([]byte(salt + strconv.FormatInt(number, 10)))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewChallenge creates a signed challenge that expires after TTL
+func (p ProofOfWork) NewChallenge(now time.Time) (Challenge, error) {
+	ttl := p.TTL
+	if ttl <= 0 {
+		ttl = DefaultChallengeTTL
+	}
+	maxNumber := p.maxNumber()
+
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return Challenge{}, err
+	}
+	params := url.Values{
+		"expires":   {strconv.FormatInt(now.Add(ttl).Unix(), 10)},
+		"maxnumber": {strconv.FormatInt(maxNumber, 10)},
+	}
+	salt := hex.EncodeToString(nonce) + "?" + params.Encode()
+
+	secret, err := rand.Int(rand.Reader, big.NewInt(maxNumber+1))
+	if err != nil {
+		return Challenge{}, err
+	}
+	challenge := hashSolution(salt, secret.Int64())
+	return Challenge{
+		Algorithm: powAlgorithm,
+		Challenge: challenge,
+		MaxNumber: maxNumber,
+		Salt:      salt,
+		Signature: p.sign(challenge),
+	}, nil
+}
+
+// Verify checks a base64 encoded solution. It implements Verifier.
+func (p ProofOfWork) Verify(token string, remoteIP string) (bool, error) {
+	return p.verify(token, time.Now())
+}
+
+func (p ProofOfWork) verify(token string, now time.Time) (bool, error) {
+	if token == "" {
+		return false, errors.New("missing-input-response")
+	}
+	data, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		return false, errors.New("invalid-input-response")
+	}
+	var sol Solution
+	if err := json.Unmarshal(data, &sol); err != nil {
+		return false, errors.New("invalid-input-response")
+	}
+	if sol.Algorithm != powAlgorithm {
+		return false, fmt.Errorf("unsupported algorithm %q", sol.Algorithm)
+	}
+
+	// the signature covers the challenge, which covers the salt and its parameters
+	if !hmac.Equal([]byte(p.sign(sol.Challenge)), []byte(sol.Signature)) {
+		return false, errors.New("invalid signature")
+	}
+	if hashSolution(sol.Salt, sol.Number) != sol.Challenge {
+		return false, errors.New("incorrect solution")
+	}
+
+	_, query, _ := strings.Cut(sol.Salt, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return false, errors.New("invalid salt")
+	}
+	expires, err := strconv.ParseInt(params.Get("expires"), 10, 64)
+	if err != nil {
+		return false, errors.New("invalid salt")
+	}
+	expiry := time.Unix(expires, 0)
+	if now.After(expiry) {
+		return false, errors.New("challenge expired")
+	}
+	maxNumber, err := strconv.ParseInt(params.Get("maxnumber"), 10, 64)
+	if err != nil || maxNumber < p.maxNumber() {
+		return false, errors.New("challenge difficulty too low")
+	}
+
+	if p.Replay != nil && !p.Replay.Use(sol.Challenge, expiry, now) {
+		return false, errors.New("challenge already used")
+	}
+	return true, nil
+}
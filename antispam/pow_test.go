@@ -0,0 +1,80 @@
+package antispam
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// solve brute-forces a challenge the way the widget does
+func solve(t *testing.T, c Challenge) Solution {
+	t.Helper()
+	for n := int64(0); n <= c.MaxNumber; n++ {
+		if hashSolution(c.Salt, n) == c.Challenge {
+			return Solution{
+				Algorithm: c.Algorithm,
+				Challenge: c.Challenge,
+				Number:    n,
+				Salt:      c.Salt,
+				Signature: c.Signature,
+			}
+		}
+	}
+	t.Fatal("No solution found")
+	return Solution{}
+}
+
+func encodeSolution(sol Solution) string {
+	data, _ := json.Marshal(sol)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestProofOfWork(t *testing.T) {
+	p := ProofOfWork{Key: []byte("key"), MaxNumber: 1000, TTL: time.Minute, Replay: NewReplayCache()}
+	now := time.Now()
+	c, err := p.NewChallenge(now)
+	if err != nil {
+		t.Fatalf("Failed to create challenge: %v", err)
+	}
+	sol := solve(t, c)
+
+	// wrong number
+	wrong := sol
+	wrong.Number = (sol.Number + 1) % (c.MaxNumber + 1)
+	if pass, _ := p.verify(encodeSolution(wrong), now); pass {
+		t.Errorf("Expected wrong number to fail")
+	}
+
+	// signed with another key
+	other := ProofOfWork{Key: []byte("other"), MaxNumber: 1000}
+	if pass, _ := other.verify(encodeSolution(sol), now); pass {
+		t.Errorf("Expected other key to fail")
+	}
+
+	// higher difficulty required
+	harder := ProofOfWork{Key: []byte("key"), MaxNumber: 5000}
+	if pass, _ := harder.verify(encodeSolution(sol), now); pass {
+		t.Errorf("Expected easier challenge to fail")
+	}
+
+	// expired
+	if pass, _ := p.verify(encodeSolution(sol), now.Add(2*time.Minute)); pass {
+		t.Errorf("Expected expired challenge to fail")
+	}
+
+	// valid once
+	if pass, err := p.verify(encodeSolution(sol), now); !pass {
+		t.Errorf("Expected pass, got %v", err)
+	}
+	if pass, _ := p.verify(encodeSolution(sol), now); pass {
+		t.Errorf("Expected replayed solution to fail")
+	}
+
+	// malformed
+	for _, token := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("{"))} {
+		if pass, _ := p.verify(token, now); pass {
+			t.Errorf("Expected %q to fail", token)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package antispam
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const recaptchaAPI = "https://www.google.com/recaptcha/api/siteverify"
+
+type recaptchaResponse struct {
+	Timestamp  string   `json:"challenge_ts"`
+	Hostname   string   `json:"hostname"`
+	Action     string   `json:"action"`
+	ErrorCodes []string `json:"error-codes"`
+	Score      *float64 `json:"score"`
+	Success    bool     `json:"success"`
+}
+
+/*
+ReCaptcha verifies Google reCAPTCHA v2 and v3 response tokens.
+For v3 tokens the score must be at least MinScore.
+
+https://developers.google.com/recaptcha/docs/verify
+*/
+type ReCaptcha struct {
+	Secret string
+	// MinScore is the lowest v3 score accepted, from 0.0 (bot) to 1.0 (human)
+	MinScore float64
+	// Action optionally checks the v3 action name
+	Action string
+	// Hostname optionally checks the site the token was issued on
+	Hostname string
+	// Endpoint defaults to the reCAPTCHA siteverify API
+	Endpoint string
+	Client   *http.Client
+}
+
+func (rc ReCaptcha) Verify(token string, remoteIP string) (bool, error) {
+	endpoint := rc.Endpoint
+	if endpoint == "" {
+		endpoint = recaptchaAPI
+	}
+	form := url.Values{
+		"secret":   {rc.Secret},
+		"response": {token},
+	}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	var respData recaptchaResponse
+	if err := siteverify(rc.Client, endpoint, form, &respData); err != nil {
+		return false, err
+	}
+	if !respData.Success {
+		return false, verifyError(respData.ErrorCodes)
+	}
+	if err := checkResponse(respData.Hostname, rc.Hostname, respData.Action, rc.Action); err != nil {
+		return false, err
+	}
+	if rc.MinScore > 0 {
+		if respData.Score == nil {
+			return false, fmt.Errorf("missing score: %w", ErrScoreTooLow)
+		}
+		if *respData.Score < rc.MinScore {
+			return false, fmt.Errorf("score %.1f is below %.1f: %w", *respData.Score, rc.MinScore, ErrScoreTooLow)
+		}
+	}
+	return true, nil
+}
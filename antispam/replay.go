@@ -0,0 +1,52 @@
+package antispam
+
+import (
+	"sync"
+	"time"
+)
+
+// how often expired tokens are dropped from a ReplayCache
+const replayPruneInterval = time.Minute
+
+// ReplayCache remembers single-use tokens until they expire
+type ReplayCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+func NewReplayCache() *ReplayCache {
+	return &ReplayCache{seen: make(map[string]time.Time)}
+}
+
+// Use marks a token as used until expires.
+// It returns false if the token was already used.
+func (c *ReplayCache) Use(token string, expires time.Time, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.lastPrune) > replayPruneInterval {
+		c.prune(now)
+	}
+	if exp, used := c.seen[token]; used && !now.After(exp) {
+		return false
+	}
+	c.seen[token] = expires
+	return true
+}
+
+// prune drops expired tokens
+func (c *ReplayCache) prune(now time.Time) {
+	for t, exp := range c.seen {
+		if now.After(exp) {
+			delete(c.seen, t)
+		}
+	}
+	c.lastPrune = now
+}
+
+// Forget removes a token so it can be used again
+func (c *ReplayCache) Forget(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.seen, token)
+}
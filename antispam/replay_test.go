@@ -0,0 +1,38 @@
+package antispam
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplayCache_Use(t *testing.T) {
+	c := NewReplayCache()
+	now := time.Now()
+	if !c.Use("a", now.Add(time.Second), now) {
+		t.Error("Expected the first use to succeed")
+	}
+	if c.Use("a", now.Add(time.Second), now) {
+		t.Error("Expected a replay to fail")
+	}
+	c.Use("b", now.Add(time.Second), now)
+
+	// expired tokens can be used again before they are pruned
+	later := now.Add(2 * time.Second)
+	if !c.Use("a", later.Add(time.Second), later) {
+		t.Error("Expected an expired token to be usable again")
+	}
+	if len(c.seen) != 2 {
+		t.Errorf("Expected no pruning within the interval, got %v", len(c.seen))
+	}
+
+	later = now.Add(replayPruneInterval + time.Minute)
+	c.Use("c", later.Add(time.Second), later)
+	if len(c.seen) != 1 {
+		t.Errorf("Expected expired tokens to be pruned, got %v", len(c.seen))
+	}
+
+	c.Forget("c")
+	if !c.Use("c", later.Add(time.Second), later) {
+		t.Error("Expected a forgotten token to be usable again")
+	}
+}
@@ -2,18 +2,21 @@ package antispam
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
 )
 
 var api = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
 
 type body struct {
-	Secret string `json:"secret"`
-	Token  string `json:"response"`
+	Secret         string `json:"secret"`
+	Token          string `json:"response"`
+	RemoteIP       string `json:"remoteip,omitempty"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
 type cfResponse struct {
@@ -34,41 +37,89 @@ Turnstile reports whether a token is valid using the Turnstile API.
 https://developers.cloudflare.com/turnstile/get-started/server-side-validation/
 */
 func Turnstile(secret string, token string) (bool, error) {
+	return TurnstileVerifier{Secret: secret}.Verify(token, "")
+}
+
+// TurnstileVerifier verifies Turnstile tokens
+type TurnstileVerifier struct {
+	Secret string
+	// Hostname optionally checks the site the token was issued on
+	Hostname string
+	// Action optionally checks the action set on the widget
+	Action string
+	// Endpoint defaults to the Turnstile siteverify API
+	Endpoint string
+	// Client defaults to a client with a 10 second timeout
+	Client *http.Client
+}
+
+/*
+Verify reports whether a token is valid. The client IP is forwarded to
+Cloudflare when known. Requests that fail in transit or with a server error
+are retried once with the same idempotency key.
+*/
+func (tv TurnstileVerifier) Verify(token string, remoteIP string) (bool, error) {
+	endpoint := tv.Endpoint
+	if endpoint == "" {
+		endpoint = api
+	}
+	client := tv.Client
+	if client == nil {
+		client = defaultClient
+	}
+
 	// create the request body
 	b := body{
-		Secret: secret,
-		Token:  token,
+		Secret:         tv.Secret,
+		Token:          token,
+		RemoteIP:       remoteIP,
+		IdempotencyKey: newUUID(),
 	}
 	bJSON, _ := json.Marshal(b)
 
 	// post the request
-	resp, err := http.Post(api, "application/json", bytes.NewBuffer(bJSON))
-	if err != nil {
-		return false, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return false, errors.New("HTTP " + strconv.Itoa(resp.StatusCode))
-	}
-
-	// parse the response
 	var respData cfResponse
-	err = json.NewDecoder(resp.Body).Decode(&respData)
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var retry bool
+		retry, err = postJSON(client, endpoint, bJSON, &respData)
+		if err == nil || !retry {
+			break
+		}
+	}
 	if err != nil {
 		return false, err
 	}
 
 	// handle validation failure
 	if !respData.Success {
-		if len(respData.ErrorCodes) > 0 {
-			errorMsg := strings.Join(respData.ErrorCodes, ", ")
-			return false, errors.New(errorMsg)
-		}
-		return false, errors.New("validation failed")
+		return false, verifyError(respData.ErrorCodes)
+	}
+	if err := checkResponse(respData.Hostname, tv.Hostname, respData.Action, tv.Action); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// postJSON posts a JSON body and decodes the response.
+// It reports whether the request can be retried on failure.
+func postJSON(client *http.Client, endpoint string, body []byte, v any) (bool, error) {
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
 	}
-	// only return true if the success field is true
-	if respData.Success {
-		return true, nil
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return resp.StatusCode >= 500, errors.New("HTTP " + strconv.Itoa(resp.StatusCode))
 	}
-	return false, errors.New("unhandled error")
+	return false, json.NewDecoder(resp.Body).Decode(v)
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
 }
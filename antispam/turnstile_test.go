@@ -1,8 +1,12 @@
 package antispam
 
 import (
+	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 type testKeys struct {
@@ -75,3 +79,79 @@ func TestTurnstile(t *testing.T) {
 		t.Errorf("Expected error '%v', but got '%v'", expectedErr, err)
 	}
 }
+
+func TestTurnstileVerifier(t *testing.T) {
+	var keys []string
+	failures := 1
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b body
+		if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+			t.Errorf("Failed to decode body: %v", err)
+		}
+		keys = append(keys, b.IdempotencyKey)
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if b.RemoteIP != "192.0.2.1" {
+			t.Errorf("Expected remoteip 192.0.2.1, got %q", b.RemoteIP)
+		}
+		if b.Token != "token" {
+			json.NewEncoder(w).Encode(cfResponse{ErrorCodes: []string{"invalid-input-response", "timeout-or-duplicate"}})
+			return
+		}
+		json.NewEncoder(w).Encode(cfResponse{Success: true, Hostname: "example.com", Action: "contact"})
+	}))
+	defer srv.Close()
+
+	// retried once with the same idempotency key
+	tv := TurnstileVerifier{Secret: "secret", Endpoint: srv.URL}
+	pass, err := tv.Verify("token", "192.0.2.1")
+	if !pass {
+		t.Errorf("Expected pass, got %v", err)
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("Expected the same idempotency key twice, got %v", keys)
+	}
+
+	tests := []struct {
+		name     string
+		verifier TurnstileVerifier
+		token    string
+		codes    []ErrorCode
+	}{
+		{"Hostname and action match", TurnstileVerifier{Hostname: "example.com", Action: "contact"}, "token", nil},
+		{"Hostname mismatch", TurnstileVerifier{Hostname: "example.org"}, "token", []ErrorCode{ErrHostnameMismatch}},
+		{"Action mismatch", TurnstileVerifier{Action: "login"}, "token", []ErrorCode{ErrActionMismatch}},
+		{"Error codes", TurnstileVerifier{}, "bad", []ErrorCode{ErrInvalidInputResponse, ErrTimeoutOrDuplicate}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tv := test.verifier
+			tv.Secret = "secret"
+			tv.Endpoint = srv.URL
+			pass, err := tv.Verify(test.token, "192.0.2.1")
+			if pass != (test.codes == nil) {
+				t.Errorf("Expected %v, got %v", test.codes == nil, pass)
+			}
+			for _, code := range test.codes {
+				if !errors.Is(err, code) {
+					t.Errorf("Expected error %v, got %v", code, err)
+				}
+			}
+		})
+	}
+}
+
+func TestTurnstileVerifier_timeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	tv := TurnstileVerifier{Endpoint: srv.URL, Client: &http.Client{Timeout: 10 * time.Millisecond}}
+	if pass, err := tv.Verify("token", ""); pass || err == nil {
+		t.Errorf("Expected timeout error, got %v %v", pass, err)
+	}
+}
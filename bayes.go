@@ -0,0 +1,144 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lkhrs/fohago/antispam"
+)
+
+const (
+	defaultMinTraining = 10
+	defaultThreshold   = 0.9
+)
+
+var errClassifierDisabled = errors.New("classifier is not enabled")
+
+// loadClassifier loads the spam classifier if it is enabled. A file that
+// can't be read fails, so the training data isn't replaced by an empty model.
+func loadClassifier(conf *Config) (*antispam.Classifier, error) {
+	if conf.Global.Bayes.File == "" {
+		return nil, nil
+	}
+	classifier, err := antispam.LoadClassifier(conf.Global.Bayes.File)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("could not load classifier: %w", err)
+	}
+	return classifier, nil
+}
+
+// submissionText joins the fields of a submission the classifier learns from:
+// the name, email and message fields, or every field if none are configured
+func submissionText(body FormBody, formCfg FormConfig) string {
+	var fields []string
+	for _, field := range []string{formCfg.Fields.Name, formCfg.Fields.Email, formCfg.Fields.Message} {
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == 0 {
+		for field := range body {
+			if field != formCfg.Fields.Honeypot {
+				fields = append(fields, field)
+			}
+		}
+		sort.Strings(fields)
+	}
+	values := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if body[field] != "" {
+			values = append(values, body[field])
+		}
+	}
+	return strings.Join(values, "\n")
+}
+
+// train teaches the classifier a submission is spam or ham and saves it
+func (fh *FormHandler) train(text string, spam bool) error {
+	if fh.Classifier == nil {
+		return errClassifierDisabled
+	}
+	fh.Classifier.Train(text, spam)
+	return fh.Classifier.Save(fh.Config.Global.Bayes.File)
+}
+
+func (c *Check) bayes(sub FormSubmission, fh FormHandler) (float64, error) {
+	if fh.Classifier == nil {
+		return 0, nil
+	}
+	minTraining := fh.Config.Global.Bayes.MinTraining
+	if minTraining <= 0 {
+		minTraining = defaultMinTraining
+	}
+	if spam, ham := fh.Classifier.Trained(); spam < minTraining || ham < minTraining {
+		return 0, nil
+	}
+	p := fh.Classifier.Probability(submissionText(sub.Body, sub.FormCfg))
+	if p < cmp.Or(fh.Config.Global.Bayes.Threshold, defaultThreshold) {
+		// only likely spam adds to the score, unknown text is 0.5
+		return 0, nil
+	}
+	return p, fmt.Errorf("spam probability %.2f", p)
+}
+
+/*
+runTrain trains the classifier from the command line:
+
+	fohago train -spam|-ham [-config fohago.toml] FILE...
+
+Each file is one submission, either plain text or a quarantined submission's JSON.
+A running server keeps the classifier in memory and overwrites the file when
+it is trained next, so stop it first or train through the admin API.
+*/
+func runTrain(args []string) int {
+	flags := flag.NewFlagSet("train", flag.ContinueOnError)
+	spam := flags.Bool("spam", false, "mark the files as spam")
+	ham := flags.Bool("ham", false, "mark the files as ham")
+	configFile := flags.String("config", "fohago.toml", "config file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *spam == *ham || flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: fohago train -spam|-ham [-config fohago.toml] FILE...")
+		return 2
+	}
+
+	conf := loadConfig(*configFile)
+	classifier, err := loadClassifier(conf)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fh := &FormHandler{Config: conf, Classifier: classifier}
+	if fh.Classifier == nil {
+		fmt.Fprintln(os.Stderr, "The classifier is not enabled, set global.bayes.file")
+		return 1
+	}
+	for _, file := range flags.Args() {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		text := string(data)
+		var record QuarantinedSubmission
+		if json.Unmarshal(data, &record) == nil && record.Body != nil {
+			text = submissionText(record.Body, conf.Forms[record.Form])
+		}
+		fh.Classifier.Train(text, *spam)
+	}
+	if err := fh.Classifier.Save(conf.Global.Bayes.File); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	spamDocs, hamDocs := fh.Classifier.Trained()
+	fmt.Printf("Trained %d file(s), classifier knows %d spam and %d ham\n", flags.NArg(), spamDocs, hamDocs)
+	return 0
+}
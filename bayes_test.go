@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lkhrs/fohago/antispam"
+)
+
+func TestCheck_bayes(t *testing.T) {
+	conf := &Config{}
+	conf.Global.Bayes.File = filepath.Join(t.TempDir(), "bayes.json")
+	conf.Global.Bayes.MinTraining = 2
+	fh := &FormHandler{Config: conf, Classifier: antispam.NewClassifier()}
+	formCfg := FormConfig{}
+	formCfg.Fields.Message = "message"
+	c := &Check{}
+
+	spam := FormSubmission{FormCfg: formCfg, Body: FormBody{"message": "cheap seo backlinks, buy now"}}
+	ham := FormSubmission{FormCfg: formCfg, Body: FormBody{"message": "can we meet on friday about the fence"}}
+
+	if err := fh.train("buy cheap seo backlinks now", true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	fh.train("please call me about the garden fence", false)
+
+	// not enough training yet
+	if p, _ := c.bayes(spam, *fh); p != 0 {
+		t.Errorf("Expected 0 before minimum training, got %v", p)
+	}
+
+	fh.train("seo backlinks cheap, buy traffic", true)
+	fh.train("meeting on friday works for me", false)
+
+	p, err := c.bayes(spam, *fh)
+	if p < 0.9 || err == nil {
+		t.Errorf("Expected spam probability above 0.9 with a reason, got %v %v", p, err)
+	}
+	if p, _ := c.bayes(ham, *fh); p != 0 {
+		t.Errorf("Expected ham not to add to the score, got %v", p)
+	}
+	for _, text := range []string{"", "unrelated words"} {
+		neutral := FormSubmission{FormCfg: formCfg, Body: FormBody{"message": text}}
+		if p, err := c.bayes(neutral, *fh); p != 0 || err != nil {
+			t.Errorf("Expected neutral text %q not to add to the score, got %v %v", text, p, err)
+		}
+	}
+
+	// the counts are saved after training
+	loaded, err := antispam.LoadClassifier(conf.Global.Bayes.File)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if spam, ham := loaded.Trained(); spam != 2 || ham != 2 {
+		t.Errorf("Expected 2 spam and 2 ham, got %v and %v", spam, ham)
+	}
+}
+
+func TestSubmissionText(t *testing.T) {
+	body := FormBody{"name": "Ann", "message": "Hello", "honeypot": "", "extra": "x"}
+	formCfg := FormConfig{}
+	if text := submissionText(body, formCfg); text != "x\nHello\nAnn" {
+		t.Errorf("Expected all fields, got %q", text)
+	}
+	formCfg.Fields.Name = "name"
+	formCfg.Fields.Message = "message"
+	if text := submissionText(body, formCfg); text != "Ann\nHello" {
+		t.Errorf("Expected name and message, got %q", text)
+	}
+}
+
+func TestLoadClassifier_corrupt(t *testing.T) {
+	conf := &Config{}
+	conf.Global.Bayes.File = filepath.Join(t.TempDir(), "bayes.json")
+	if classifier, err := loadClassifier(conf); classifier == nil || err != nil {
+		t.Errorf("Expected an empty classifier for a missing file, got %v", err)
+	}
+	if err := os.WriteFile(conf.Global.Bayes.File, []byte("{corrupt"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFormHandler(conf); err == nil {
+		t.Error("Expected a corrupt classifier to fail, got nil")
+	}
+	if data, _ := os.ReadFile(conf.Global.Bayes.File); string(data) != "{corrupt" {
+		t.Errorf("Expected the file to be kept, got %v", string(data))
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"log/slog"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	matchSubstring = "substring"
+	matchWord      = "word"
+	matchRegex     = "regex"
+)
+
+// parseBlockTerm turns a blocklist term into a rule. Terms are case-insensitive
+// substrings, unless prefixed with "word:" for whole words or "re:" for a
+// regular expression.
+func parseBlockTerm(term string) BlockRule {
+	if pattern, found := strings.CutPrefix(term, "word:"); found {
+		return BlockRule{Pattern: pattern, Match: matchWord}
+	}
+	if pattern, found := strings.CutPrefix(term, "re:"); found {
+		return BlockRule{Pattern: pattern, Match: matchRegex}
+	}
+	return BlockRule{Pattern: term, Match: matchSubstring}
+}
+
+// fieldsFor returns the names of the submitted fields the rule applies to
+func (rule BlockRule) fieldsFor(sub FormSubmission) []string {
+	if len(rule.Fields) == 0 {
+		var fields []string
+		for _, field := range []string{sub.FormCfg.Fields.Message, sub.FormCfg.Fields.Name, sub.FormCfg.Fields.Email} {
+			if field != "" {
+				fields = append(fields, field)
+			}
+		}
+		return fields
+	}
+	if len(rule.Fields) == 1 && rule.Fields[0] == "*" {
+		fields := make([]string, 0, len(sub.Body))
+		for field := range sub.Body {
+			if field != sub.FormCfg.Fields.Honeypot {
+				fields = append(fields, field)
+			}
+		}
+		sort.Strings(fields)
+		return fields
+	}
+	return rule.Fields
+}
+
+// matcher reports whether normalized text matches a rule
+type matcher func(text string) bool
+
+// compiled rules are cached since the same rules are checked on every
+// submission, and cleared when the blocklist file changes
+var matcherCache sync.Map
+
+// newBlocklistFile loads the blocklist file, dropping the cached rules of
+// removed terms whenever it is reloaded
+func newBlocklistFile(path string) *listFile[[]string] {
+	return newListFile(path, func(lines []string) ([]string, error) {
+		matcherCache.Clear()
+		return lines, nil
+	})
+}
+
+func (rule BlockRule) matcher() matcher {
+	key := rule.Match + "\x00" + rule.Pattern
+	if m, ok := matcherCache.Load(key); ok {
+		return m.(matcher)
+	}
+	m := rule.compile()
+	matcherCache.Store(key, m)
+	return m
+}
+
+func (rule BlockRule) compile() matcher {
+	switch rule.Match {
+	case matchRegex:
+		re, err := compileNormalizedRegex(rule.Pattern)
+		if err != nil {
+			slog.Error("Invalid blocklist regex:", slog.String("pattern", rule.Pattern), slog.Any("error", err))
+			return func(string) bool { return false }
+		}
+		return re.MatchString
+	case matchWord:
+		word := normalizeText(rule.Pattern)
+		return func(text string) bool { return containsWord(text, word) }
+	case "", matchSubstring:
+		term := normalizeText(rule.Pattern)
+		return func(text string) bool { return term != "" && strings.Contains(text, term) }
+	}
+	slog.Error("Unknown blocklist match type:", slog.String("match", rule.Match))
+	return func(string) bool { return false }
+}
+
+// compileNormalizedRegex compiles a case-insensitive regex for normalized
+// text. Its literal characters are normalized like the text, so "Café"
+// matches "cafe", character classes are used as written.
+func compileNormalizedRegex(pattern string) (*regexp.Regexp, error) {
+	re, err := syntax.Parse("(?i)"+pattern, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	normalizeLiterals(re)
+	return regexp.Compile(re.String())
+}
+
+func normalizeLiterals(re *syntax.Regexp) {
+	if re.Op == syntax.OpLiteral {
+		re.Rune = []rune(normalizeText(string(re.Rune)))
+	}
+	for _, sub := range re.Sub {
+		normalizeLiterals(sub)
+	}
+}
+
+// containsWord reports whether word appears in text surrounded by non-word characters
+func containsWord(text, word string) bool {
+	if word == "" {
+		return false
+	}
+	for offset := 0; offset < len(text); {
+		i := strings.Index(text[offset:], word)
+		if i < 0 {
+			return false
+		}
+		start := offset + i
+		end := start + len(word)
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if (start == 0 || !isWordRune(before)) && (end == len(text) || !isWordRune(after)) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(text[start:])
+		offset = start + size
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
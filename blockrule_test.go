@@ -0,0 +1,82 @@
+package main
+
+import "testing"
+
+func TestNormalizeText(t *testing.T) {
+	tests := map[string]string{
+		"CASINO":           "casino",
+		"Cаsіno":           "casino", // Cyrillic а and і
+		"ＣＡＳＩＮＯ":           "casino", // fullwidth
+		"𝐜𝐚𝐬𝐢𝐧𝐨":           "casino", // mathematical bold
+		"cas\u200bino":     "casino", // zero width space
+		"Café Crème":       "cafe creme",
+		"cafe\u0301":       "cafe", // combining acute accent
+		"ⓒⓐⓢⓘⓝⓞ":           "casino",
+		"Straße":           "strasse",
+		"plain text stays": "plain text stays",
+	}
+	for input, expected := range tests {
+		if result := normalizeText(input); result != expected {
+			t.Errorf("normalizeText(%q): Expected %q, got %q", input, expected, result)
+		}
+	}
+}
+
+func TestContainsWord(t *testing.T) {
+	tests := []struct {
+		text     string
+		word     string
+		expected bool
+	}{
+		{"visit our casino now", "casino", true},
+		{"casino", "casino", true},
+		{"casino.", "casino", true},
+		{"casinos", "casino", false},
+		{"the casinoroyale and casino", "casino", true},
+		{"occasional", "casino", false},
+		{"", "casino", false},
+		{"casino", "", false},
+	}
+	for _, test := range tests {
+		if result := containsWord(test.text, test.word); result != test.expected {
+			t.Errorf("containsWord(%q, %q): Expected %v, got %v", test.text, test.word, test.expected, result)
+		}
+	}
+}
+
+func TestParseBlockTerm(t *testing.T) {
+	tests := map[string]BlockRule{
+		"casino":      {Pattern: "casino", Match: matchSubstring},
+		"word:http":   {Pattern: "http", Match: matchWord},
+		`re:bit\.ly/`: {Pattern: `bit\.ly/`, Match: matchRegex},
+	}
+	for term, expected := range tests {
+		rule := parseBlockTerm(term)
+		if rule.Pattern != expected.Pattern || rule.Match != expected.Match {
+			t.Errorf("parseBlockTerm(%q): Expected %+v, got %+v", term, expected, rule)
+		}
+	}
+}
+
+func TestCompileNormalizedRegex(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		text     string
+		expected bool
+	}{
+		{`Café\s+crème`, "CAFE  Creme", true},
+		{`CASINO`, "Cаsіno", true},
+		{`^\S+@Bit\.LY$`, "ann@bit.ly", true},
+		{`\W`, "abc", false},
+		{`[A-Z]+ royale`, "casino royale", true},
+	}
+	for _, test := range tests {
+		re, err := compileNormalizedRegex(test.pattern)
+		if err != nil {
+			t.Fatalf("%s: Expected no error, got %v", test.pattern, err)
+		}
+		if match := re.MatchString(normalizeText(test.text)); match != test.expected {
+			t.Errorf("%s: Expected %v, got %v", test.pattern, test.expected, match)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/lkhrs/fohago/antispam"
+)
+
+// proofOfWork returns the proof-of-work verifier for a form's captcha config
+func (fh *FormHandler) proofOfWork(cfg CaptchaConfig) antispam.ProofOfWork {
+	return antispam.ProofOfWork{
+		Key:       fh.Config.signingKey(),
+		MaxNumber: cfg.Difficulty,
+		TTL:       cfg.Expires,
+		Replay:    fh.Replay,
+	}
+}
+
+// handleChallenge issues a signed proof-of-work challenge for a form
+func (fh *FormHandler) handleChallenge(w http.ResponseWriter, r *http.Request) {
+	formCfg, exists := fh.Config.Forms[r.PathValue("id")]
+	if !exists || formCfg.Captcha.Provider != "pow" {
+		http.NotFound(w, r)
+		return
+	}
+	challenge, err := fh.proofOfWork(formCfg.Captcha).NewChallenge(time.Now())
+	if err != nil {
+		slog.Error("Failed to create challenge:", slog.Any("error", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(challenge)
+}
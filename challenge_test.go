@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/lkhrs/fohago/antispam"
+)
+
+func TestFormHandler_handleChallenge(t *testing.T) {
+	conf := &Config{Forms: map[string]FormConfig{
+		"contact": {Captcha: CaptchaConfig{Provider: "pow", Difficulty: 500}},
+		"plain":   {},
+	}}
+	conf.Global.SecretKey = "secret"
+	fh, err := NewFormHandler(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{id}/challenge", fh.handleChallenge)
+
+	for _, id := range []string{"plain", "unknown"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/"+id+"/challenge", nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: Expected %v, got %v", id, http.StatusNotFound, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/contact/challenge", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %v, got %v", http.StatusOK, w.Code)
+	}
+	var challenge antispam.Challenge
+	if err := json.NewDecoder(w.Body).Decode(&challenge); err != nil {
+		t.Fatalf("Failed to decode challenge: %v", err)
+	}
+	if challenge.MaxNumber != 500 {
+		t.Errorf("Expected max number 500, got %v", challenge.MaxNumber)
+	}
+
+	// solve it and submit the solution through the captcha check
+	solution := antispam.Solution{
+		Algorithm: challenge.Algorithm,
+		Challenge: challenge.Challenge,
+		Salt:      challenge.Salt,
+		Signature: challenge.Signature,
+	}
+	for n := int64(0); n <= challenge.MaxNumber; n++ {
+		sum := sha256.Sum256([]byte(challenge.Salt + strconv.FormatInt(n, 10)))
+		if hex.EncodeToString(sum[:]) == challenge.Challenge {
+			solution.Number = n
+			break
+		}
+	}
+	data, _ := json.Marshal(solution)
+	sub := FormSubmission{
+		Id:      "contact",
+		FormCfg: conf.Forms["contact"],
+		Body:    FormBody{"altcha": base64.StdEncoding.EncodeToString(data)},
+	}
+	c := &Check{}
+	if pass, err := c.captcha(sub, *fh); !pass {
+		t.Errorf("Expected pass, got %v", err)
+	}
+	if pass, _ := c.captcha(sub, *fh); pass {
+		t.Errorf("Expected replayed solution to fail")
+	}
+}
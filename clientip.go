@@ -0,0 +1,143 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parsePrefixes parses a list of CIDRs or single IP addresses
+func parsePrefixes(list []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(list))
+	for _, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, err
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// containsAddr reports whether any of the prefixes contains the address
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwarding headers a trusted proxy may set, only the configured one is read
+var forwardedHeaders = []string{"X-Forwarded-For", "Forwarded", "X-Real-IP"}
+
+// forwardedHeader returns the configured forwarding header, X-Forwarded-For by default
+func forwardedHeader(name string) (string, error) {
+	if name == "" {
+		return forwardedHeaders[0], nil
+	}
+	for _, header := range forwardedHeaders {
+		if strings.EqualFold(name, header) {
+			return header, nil
+		}
+	}
+	return "", fmt.Errorf("unknown forwarded header %q", name)
+}
+
+// getClientIP returns the address of the client. The forwarding header is
+// only honored when the request comes from a trusted proxy, and the chain is
+// walked from the right so that only entries added by trusted hops are
+// believed. Other forwarding headers are ignored, as proxies pass them through.
+func (fh *FormHandler) getClientIP(r *http.Request) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	addr, err := netip.ParseAddr(remote)
+	if err != nil {
+		return remote
+	}
+	addr = addr.Unmap()
+	if !containsAddr(fh.TrustedProxies, addr) {
+		return addr.String()
+	}
+
+	header := cmp.Or(fh.ForwardedHeader, forwardedHeaders[0])
+	if header == "X-Real-IP" {
+		if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get(header))); err == nil {
+			return realIP.Unmap().String()
+		}
+		return addr.String()
+	}
+	chain := forwardedFor(r.Header, header)
+
+	client := addr
+	for i := len(chain) - 1; i >= 0; i-- {
+		hop, ok := parseForwardedAddr(chain[i])
+		if !ok {
+			// obfuscated or malformed entries can't be trusted any further
+			break
+		}
+		client = hop
+		if !containsAddr(fh.TrustedProxies, hop) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// forwardedFor returns the forwarding chain from the Forwarded header
+// (RFC 7239) or X-Forwarded-For
+func forwardedFor(h http.Header, header string) []string {
+	var chain []string
+	if header != "Forwarded" {
+		for _, line := range h.Values("X-Forwarded-For") {
+			chain = append(chain, strings.Split(line, ",")...)
+		}
+		return chain
+	}
+	for _, line := range h.Values("Forwarded") {
+		for _, element := range strings.Split(line, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if found && strings.EqualFold(key, "for") {
+					chain = append(chain, value)
+				}
+			}
+		}
+	}
+	return chain
+}
+
+// parseForwardedAddr parses a node from a forwarding header, e.g.
+// 192.0.2.1, "[2001:db8::1]:4711" or 192.0.2.1:80
+func parseForwardedAddr(node string) (netip.Addr, bool) {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+	if addrPort, err := netip.ParseAddrPort(node); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	node = strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+	addr, err := netip.ParseAddr(node)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lkhrs/fohago/middleware"
+)
+
+func TestFormHandler_getClientIP(t *testing.T) {
+	trusted, err := parsePrefixes([]string{"10.0.0.0/8", "2001:db8:1::/48", "192.0.2.10"})
+	if err != nil {
+		t.Fatalf("Failed to parse prefixes: %v", err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		headers    map[string]string
+		expected   string
+	}{
+		{
+			name:       "Untrusted remote ignores headers",
+			remoteAddr: "203.0.113.5:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Real-IP": "1.2.3.4"},
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "Trusted remote without headers",
+			remoteAddr: "10.0.0.1:1234",
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "X-Real-IP from trusted remote",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "X-Real-IP",
+			headers:    map[string]string{"X-Real-IP": "198.51.100.7", "X-Forwarded-For": "1.2.3.4"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "X-Real-IP is ignored by default",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Real-IP": "1.2.3.4"},
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "Spoofed X-Forwarded-For entry is skipped",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7, 10.0.0.2"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "Single trusted IP",
+			remoteAddr: "192.0.2.10:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.7"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "Forwarded header passed through a X-Forwarded-For proxy is ignored",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				"Forwarded":       "for=1.2.3.4",
+				"X-Forwarded-For": "198.51.100.7",
+			},
+			expected: "198.51.100.7",
+		},
+		{
+			name:       "Forwarded header when configured",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "Forwarded",
+			headers: map[string]string{
+				"Forwarded":       `for=1.2.3.4, for="[2001:db8:cafe::17]:4711";proto=https, for=10.0.0.3`,
+				"X-Forwarded-For": "198.51.100.7",
+			},
+			expected: "2001:db8:cafe::17",
+		},
+		{
+			name:       "Obfuscated Forwarded node stops the walk",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "Forwarded",
+			headers:    map[string]string{"Forwarded": "for=198.51.100.7, for=_hidden, for=10.0.0.3"},
+			expected:   "10.0.0.3",
+		},
+		{
+			name:       "All hops trusted",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.4, 10.0.0.3"},
+			expected:   "10.0.0.4",
+		},
+		{
+			name:       "IPv6 remote",
+			remoteAddr: "[2001:db8:1::1]:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.9"},
+			expected:   "203.0.113.9",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := http.NewRequest("POST", "/contact", nil)
+			r.RemoteAddr = test.remoteAddr
+			for k, v := range test.headers {
+				r.Header.Set(k, v)
+			}
+			fh := &FormHandler{TrustedProxies: trusted, ForwardedHeader: test.header}
+			if ip := fh.getClientIP(r); ip != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, ip)
+			}
+		})
+	}
+}
+
+func TestNewFormHandler_invalidConfig(t *testing.T) {
+	for _, global := range []GlobalConfig{
+		{TrustedProxies: []string{"10.0.0.0/33"}},
+		{ForwardedHeader: "X-Client-IP"},
+		{IPFilter: IPFilterConfig{Block: []string{"203.0.113.0/24", "203.0.113.300"}}},
+	} {
+		if _, err := NewFormHandler(&Config{Global: global}); err == nil {
+			t.Errorf("Expected an error for %+v, got nil", global)
+		}
+	}
+}
+
+func TestFormHandler_clientIPAccessLog(t *testing.T) {
+	fh, err := NewFormHandler(&Config{Global: GlobalConfig{TrustedProxies: []string{"10.0.0.0/8"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	handler := middleware.Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fh.process(r)
+	}), slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	r := httptest.NewRequest("POST", "/contact", nil)
+	r.RemoteAddr = "10.0.0.2:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.9")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	var entry struct {
+		RemoteAddr string `json:"remote_addr"`
+		ClientIP   string `json:"client_ip"`
+	}
+	json.Unmarshal(buf.Bytes(), &entry)
+	if entry.ClientIP != "203.0.113.9" || entry.RemoteAddr != "10.0.0.2" {
+		t.Errorf("Expected %v from %v, got %v from %v", "203.0.113.9", "10.0.0.2", entry.ClientIP, entry.RemoteAddr)
+	}
+}
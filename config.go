@@ -1,9 +1,12 @@
 package main
 
 import (
+	"crypto/rand"
 	"fmt"
 	"log/slog"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/caarlos0/env"
@@ -17,12 +20,290 @@ type Config struct {
 		Host     string `env:"SMTP_HOST" envDefault:"localhost"`
 		Port     int    `env:"SMTP_PORT" envDefault:"1025"`
 	}
-	Global struct {
-		Blocklist []string `env:"BLOCKLIST" envSeparator:","`
-		Port      int      `env:"PORT" envDefault:"8080"`
-		BaseUrl   string
-		LogLevel  string
+	Global GlobalConfig
+}
+
+type GlobalConfig struct {
+	Blocklist []string `env:"BLOCKLIST" envSeparator:","`
+	// BlocklistFile holds more terms, one per line, and is edited through the admin API
+	BlocklistFile string
+	Rules         []BlockRule
+	Port          int `env:"PORT" envDefault:"8080"`
+	BaseUrl       string
+	// LogLevel is the service log level if Log.Level is not set
+	LogLevel string
+	// Log is the service log, written as text to stdout and fohago.log by default
+	Log LogConfig
+	// AccessLog is written as JSON to access_log.json by default
+	AccessLog LogConfig
+	// LogProbes writes /healthz, /readyz, /version and /metrics requests to the access log
+	LogProbes bool
+	// SecretKey signs challenges and tokens, a random key is used if empty
+	SecretKey string `env:"SECRET_KEY"`
+	// AdminToken enables the admin API for requests with the bearer token
+	AdminToken string `env:"ADMIN_TOKEN"`
+	// Admins maps names to admin tokens so changes are logged with who made them
+	Admins map[string]string
+	// TrustedProxies lists the CIDRs of proxies allowed to set forwarding headers
+	TrustedProxies []string `env:"TRUSTED_PROXIES" envSeparator:","`
+	// ForwardedHeader is the one header read from trusted proxies:
+	// "X-Forwarded-For" (default), "Forwarded" or "X-Real-IP"
+	ForwardedHeader string `env:"FORWARDED_HEADER"`
+	IPFilter        IPFilterConfig
+	Quarantine      struct {
+		Dir string
+	}
+	Email struct {
+		// Disposable domains, inline or in a file with one domain per line
+		Disposable     []string
+		DisposableFile string
+		// Resolver is the DNS server used for MX lookups, e.g. "1.1.1.1:53",
+		// the system resolver is used when empty
+		Resolver string
+		Timeout  time.Duration
+	}
+	// Bayes enables the spam classifier, which keeps its token counts in File
+	Bayes struct {
+		File string
+		// MinTraining is how many spam and ham submissions each are needed
+		// before the classifier is used, defaults to 10
+		MinTraining int
+		// Threshold is the spam probability at which the check fails, defaults to 0.9
+		Threshold float64
+	}
+	// Feedback adds signed "mark as spam" and "not spam" links to delivered
+	// emails. Delivered submissions are kept in Dir until the links expire.
+	Feedback struct {
+		Enabled bool
+		// Dir defaults to "feedback"
+		Dir string
+		// Expires defaults to 30 days
+		Expires time.Duration
+	}
+	// Reputation keeps per-IP spam and ham counts from feedback in File
+	Reputation struct {
+		File string
 	}
+	Limits LimitsConfig
+	Server ServerConfig
+	TLS    TLSConfig
+	// Queue delivers mail in the background with Workers goroutines,
+	// delivery is synchronous when Workers is 0
+	Queue struct {
+		Workers int
+		// Size is how many submissions can wait, defaults to 100
+		Size int
+		// Retries defaults to 3, -1 disables them
+		Retries int
+		// RetryDelay doubles after each retry, defaults to 5s
+		RetryDelay time.Duration
+	}
+	GeoIP struct {
+		// Database is a MaxMind DB file with country data, e.g. GeoLite2-Country.mmdb
+		Database string
+	}
+	RateLimit struct {
+		RateLimitConfig
+		// Backend is "memory" (default) or "file"
+		Backend string
+		File    string
+	}
+}
+
+// BlockRule rejects submissions where a field matches Pattern.
+// Matching is case-insensitive and runs on normalized text, with accents
+// and lookalike characters folded. Regex literals are normalized the same
+// way, character classes are not.
+type BlockRule struct {
+	Pattern string
+	// Match is "substring" (default), "word" or "regex"
+	Match string
+	// Fields defaults to the name, email and message fields, "*" checks all fields
+	Fields []string
+}
+
+// CaptchaConfig selects the captcha provider that verifies a form's submissions
+type CaptchaConfig struct {
+	// Provider is "turnstile", "hcaptcha", "recaptcha" or "pow" for the
+	// self-hosted proof-of-work challenge
+	Provider string
+	Secret   string
+	// SiteKey is checked by hCaptcha when set
+	SiteKey string
+	// MinScore is the lowest reCAPTCHA v3 score accepted
+	MinScore float64
+	// Hostname is the expected site hostname of the token
+	Hostname string
+	// Action is the expected Turnstile or reCAPTCHA v3 action
+	Action string
+	// Endpoint overrides the provider's verify URL
+	Endpoint string
+	// Timeout for verify requests, defaults to 10s
+	Timeout time.Duration
+	// Difficulty is the proof-of-work max number
+	Difficulty int64
+	// Expires is how long a proof-of-work challenge is valid for
+	Expires time.Duration
+}
+
+// FillTimeConfig rejects submissions that arrive sooner than Min or later
+// than Max after the form's signed token was issued
+type FillTimeConfig struct {
+	Min time.Duration
+	// Max defaults to 24h
+	Max time.Duration
+	// Field holding the token, defaults to "fohago-token"
+	Field string
+}
+
+// HeuristicsConfig sets content limits for the name, email and message
+// fields. Zero values disable a limit, except for MaxLinks which is only
+// disabled when unset.
+type HeuristicsConfig struct {
+	// MaxLinks is the number of URLs allowed across the fields, unset
+	// disables the limit and 0 allows no links
+	MaxLinks *int
+	// BlockMarkup rejects BBCode and HTML links
+	BlockMarkup bool
+	// Scripts lists the allowed Unicode scripts, e.g. ["Latin"]
+	Scripts []string
+	// MaxUppercase is the highest share of uppercase letters, e.g. 0.7
+	MaxUppercase float64
+	// MaxRepeat is the longest run of the same character allowed
+	MaxRepeat int
+}
+
+// EmailCheckConfig enables validation of the email field
+type EmailCheckConfig struct {
+	// Enabled checks the address syntax and rejects disposable domains
+	Enabled bool
+	// MX also requires the domain to have a mail server
+	MX bool
+}
+
+// DedupConfig drops duplicate submissions of a form within Window.
+// Duplicates get the success response but are not delivered again.
+type DedupConfig struct {
+	Window time.Duration
+	// Field holding an optional idempotency key, defaults to "idempotency-key".
+	// The Idempotency-Key header is honored as well.
+	Field string
+}
+
+// SpamConfig sets how the spam check scores decide a submission's fate.
+// Each failing check adds its weight to the score, negative weights lower it.
+type SpamConfig struct {
+	// Weights by check name, checks default to 1
+	Weights map[string]float64
+	// RejectScore rejects submissions at or above the score, defaults to 1
+	RejectScore float64
+	// QuarantineScore quarantines submissions at or above the score, 0 disables quarantine
+	QuarantineScore float64
+	// Quarantine is "store" (default) to save submissions to Global.Quarantine.Dir
+	// or "email" to deliver them with a [SPAM] subject tag
+	Quarantine string
+}
+
+// LogConfig sets where a log is written, how and from which level
+type LogConfig struct {
+	// Outputs are "stdout", "stderr", "syslog" for the local syslog daemon,
+	// "syslog://host:514" (UDP) or "syslog+tcp://host:514", or file paths
+	Outputs []string
+	// Format is "text" or "json", the access log also takes "combined"
+	// for the Combined Log Format
+	Format string
+	// Level is "debug", "info" (default), "warn" or "error". Request headers
+	// are added to the access log at "debug".
+	Level string
+	// MaxSize rotates log files larger than this many megabytes
+	MaxSize int64
+	// Interval rotates log files this long after they were opened
+	Interval time.Duration
+	// MaxBackups is how many rotated files are kept, 0 keeps all
+	MaxBackups int
+	// PII is "keep" (default), "redact" to remove IP and email addresses
+	// or "hash" to replace them with a keyed hash
+	PII string
+}
+
+// ServerConfig sets how the HTTP server listens and its timeouts
+type ServerConfig struct {
+	// Listen is a TCP address like "127.0.0.1:8080", "unix:/run/fohago.sock"
+	// or "systemd" for socket activation. Defaults to PORT on all interfaces.
+	Listen string
+	// SocketMode is the permission of a Unix socket, defaults to 0o660
+	SocketMode        os.FileMode
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// ShutdownTimeout is how long requests and queued mail get to finish
+	// after SIGTERM, defaults to 30s
+	ShutdownTimeout time.Duration
+}
+
+// TLSConfig enables HTTPS. Certificates are reloaded when the files change
+// or on SIGHUP.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// MinVersion is "1.2" (default) or "1.3"
+	MinVersion string
+	// ClientCA requires admin API clients to present a certificate signed by it
+	ClientCA string
+	// RedirectHTTP is an address like ":80" that redirects to HTTPS
+	RedirectHTTP string
+}
+
+// LimitsConfig caps the size of submissions, larger ones are rejected
+// before any spam check
+type LimitsConfig struct {
+	// MaxBodySize in bytes, defaults to 1 MiB
+	MaxBodySize int64
+	// MaxFields is the number of submitted values, defaults to 100
+	MaxFields int
+	// MaxValueLength is the characters allowed per value, defaults to 65536
+	MaxValueLength int
+}
+
+// RedirectConfig sets where visitors are sent after submitting a form
+type RedirectConfig struct {
+	// Success defaults to /success.html
+	Success string
+	// Error is where failed submissions are sent instead of an error page
+	Error string
+	// Spam and Invalid override Error for spam and malformed submissions
+	Spam    string
+	Invalid string
+	// Params adds the error code to the redirect as ?error=...
+	Params bool
+	// State adds an encrypted ?state=... token with the submitted values,
+	// which /{id}/state exchanges so the page can fill the form in again
+	State bool
+}
+
+// GeoIPConfig restricts a form to submissions from the listed countries,
+// given as ISO 3166-1 codes like "DE". Global.GeoIP.Database is required.
+type GeoIPConfig struct {
+	Allow []string
+	Deny  []string
+}
+
+// IPFilterConfig lists IPs or CIDRs to allow or block, inline or in files
+// with one entry per line. Allowed IPs skip the spam checks.
+type IPFilterConfig struct {
+	Allow     []string
+	Block     []string
+	AllowFile string
+	BlockFile string
+}
+
+// RateLimitConfig configures a token bucket: Requests tokens are added
+// every Period, up to Burst tokens. A zero Requests disables the limit.
+type RateLimitConfig struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
 }
 
 type FormBody map[string]string
@@ -36,16 +317,25 @@ type FormConfig struct {
 		Subject   string
 	}
 	TurnstileKey string
+	Captcha      CaptchaConfig
 	Fields       struct {
 		Name     string
 		Email    string
 		Message  string
 		Honeypot string
 	}
-	Blocklist []string
-	Redirects struct {
-		Success string
-	}
+	Blocklist  []string
+	Rules      []BlockRule
+	Redirects  RedirectConfig
+	RateLimit  RateLimitConfig
+	IPFilter   IPFilterConfig
+	Spam       SpamConfig
+	FillTime   FillTimeConfig
+	Heuristics HeuristicsConfig
+	EmailCheck EmailCheckConfig
+	Dedup      DedupConfig
+	GeoIP      GeoIPConfig
+	Limits     LimitsConfig
 }
 
 // check the config for required fields
@@ -88,6 +378,24 @@ func loadFromToml(cfg *Config, path string) error {
 	return nil
 }
 
+var (
+	randomKey     []byte
+	randomKeyOnce sync.Once
+)
+
+// signingKey returns the key used to sign challenges and tokens
+func (c *Config) signingKey() []byte {
+	if c.Global.SecretKey != "" {
+		return []byte(c.Global.SecretKey)
+	}
+	randomKeyOnce.Do(func() {
+		randomKey = make([]byte, 32)
+		rand.Read(randomKey)
+		slog.Warn("SECRET_KEY is not set, using a random key. Tokens will not survive a restart.")
+	})
+	return randomKey
+}
+
 func loadConfig(file string) *Config {
 	cfg := &Config{}
 
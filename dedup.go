@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"time"
+)
+
+const defaultIdempotencyField = "idempotency-key"
+
+func (cfg DedupConfig) field() string {
+	if cfg.Field == "" {
+		return defaultIdempotencyField
+	}
+	return cfg.Field
+}
+
+// volatileFields returns the fields that differ between otherwise identical
+// submissions, such as captcha responses and tokens
+func volatileFields(formCfg FormConfig) map[string]bool {
+	volatile := map[string]bool{
+		formCfg.FillTime.field(): true,
+		formCfg.Dedup.field():    true,
+		formCfg.Fields.Honeypot:  true,
+	}
+	for _, field := range captchaFields {
+		volatile[field] = true
+	}
+	return volatile
+}
+
+// contentHash hashes the submitted values, ignoring volatile fields
+func contentHash(sub FormSubmission) string {
+	volatile := volatileFields(sub.FormCfg)
+	keys := make([]string, 0, len(sub.Body))
+	for k := range sub.Body {
+		if !volatile[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(sub.Body[k]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// dedupKeys returns the keys identifying a submission: its content hash and,
+// if the client sent one, its idempotency key
+func dedupKeys(sub FormSubmission) []string {
+	keys := []string{sub.Id + " content " + contentHash(sub)}
+	if sub.IdempotencyKey != "" {
+		keys = append(keys, sub.Id+" key "+sub.IdempotencyKey)
+	}
+	return keys
+}
+
+// claimSubmission records a submission for the form's dedup window and
+// reports whether it is new. Release the claim if delivery fails so the
+// client can retry.
+func (fh *FormHandler) claimSubmission(sub FormSubmission) bool {
+	window := sub.FormCfg.Dedup.Window
+	if window <= 0 || fh.Dedup == nil {
+		return true
+	}
+	now := time.Now()
+	keys := dedupKeys(sub)
+	for i, key := range keys {
+		if !fh.Dedup.Use(key, now.Add(window), now) {
+			for _, claimed := range keys[:i] {
+				fh.Dedup.Forget(claimed)
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// releaseSubmission forgets a claimed submission
+func (fh *FormHandler) releaseSubmission(sub FormSubmission) {
+	if sub.FormCfg.Dedup.Window <= 0 || fh.Dedup == nil {
+		return
+	}
+	for _, key := range dedupKeys(sub) {
+		fh.Dedup.Forget(key)
+	}
+}
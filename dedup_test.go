@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lkhrs/fohago/antispam"
+)
+
+func TestFormHandler_claimSubmission(t *testing.T) {
+	fh := &FormHandler{Config: &Config{}, Dedup: antispam.NewReplayCache()}
+	formCfg := FormConfig{Dedup: DedupConfig{Window: time.Minute}}
+	formCfg.Fields.Honeypot = "honeypot"
+
+	sub := FormSubmission{
+		Id:      "contact",
+		FormCfg: formCfg,
+		Body:    FormBody{"message": "hello", "cf-turnstile-response": "token1"},
+	}
+	if !fh.claimSubmission(sub) {
+		t.Errorf("Expected first submission to be new")
+	}
+
+	// a replay with a fresh captcha token is still a duplicate
+	replay := sub
+	replay.Body = FormBody{"message": "hello", "cf-turnstile-response": "token2", "honeypot": ""}
+	if fh.claimSubmission(replay) {
+		t.Errorf("Expected replay to be a duplicate")
+	}
+
+	// the same message on another form is not
+	other := sub
+	other.Id = "quote"
+	if !fh.claimSubmission(other) {
+		t.Errorf("Expected submission to another form to be new")
+	}
+
+	// a failed delivery can be retried
+	fh.releaseSubmission(sub)
+	if !fh.claimSubmission(sub) {
+		t.Errorf("Expected released submission to be new")
+	}
+
+	// the idempotency key marks edited retries as duplicates
+	first := FormSubmission{Id: "contact", FormCfg: formCfg, Body: FormBody{"message": "hi"}, IdempotencyKey: "abc"}
+	edited := FormSubmission{Id: "contact", FormCfg: formCfg, Body: FormBody{"message": "hi!"}, IdempotencyKey: "abc"}
+	if !fh.claimSubmission(first) {
+		t.Errorf("Expected first keyed submission to be new")
+	}
+	if fh.claimSubmission(edited) {
+		t.Errorf("Expected submission with the same idempotency key to be a duplicate")
+	}
+	// the rejected duplicate did not claim its content
+	edited.IdempotencyKey = ""
+	if !fh.claimSubmission(edited) {
+		t.Errorf("Expected edited content without key to be new")
+	}
+
+	// disabled without a window
+	sub.FormCfg.Dedup.Window = 0
+	if !fh.claimSubmission(sub) || !fh.claimSubmission(sub) {
+		t.Errorf("Expected no deduplication without a window")
+	}
+}
+
+func TestFormHandler_deliveryFailedReleasesClaim(t *testing.T) {
+	fh := &FormHandler{
+		Config:     &Config{},
+		Dedup:      antispam.NewReplayCache(),
+		Quarantine: &Quarantine{Dir: t.TempDir()},
+	}
+	sub := FormSubmission{
+		Id:      "contact",
+		FormCfg: FormConfig{Dedup: DedupConfig{Window: time.Minute}},
+		Body:    FormBody{"message": "hello"},
+	}
+	fh.claimSubmission(sub)
+	fh.deliveryFailed(sub, errors.New("connection refused"))
+	if !fh.claimSubmission(sub) {
+		t.Error("Expected the retry after a failed delivery to be new")
+	}
+	if ids, _ := fh.Quarantine.List("contact"); len(ids) != 1 {
+		t.Errorf("Expected %v, got %v", 1, len(ids))
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const defaultDNSTimeout = 5 * time.Second
+
+// EmailChecker validates the email field of submissions
+type EmailChecker struct {
+	disposable     map[string]bool
+	disposableFile *listFile[map[string]bool]
+	resolver       *net.Resolver
+	timeout        time.Duration
+}
+
+func domainSet(lines []string) (map[string]bool, error) {
+	set := make(map[string]bool, len(lines))
+	for _, line := range lines {
+		set[strings.ToLower(strings.TrimSpace(line))] = true
+	}
+	return set, nil
+}
+
+func NewEmailChecker(conf *Config) *EmailChecker {
+	cfg := conf.Global.Email
+	ec := &EmailChecker{timeout: cfg.Timeout}
+	ec.disposable, _ = domainSet(cfg.Disposable)
+	if cfg.DisposableFile != "" {
+		ec.disposableFile = newListFile(cfg.DisposableFile, domainSet)
+	}
+	if ec.timeout <= 0 {
+		ec.timeout = defaultDNSTimeout
+	}
+	ec.resolver = net.DefaultResolver
+	if cfg.Resolver != "" {
+		// send all queries to the configured DNS server
+		ec.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, cfg.Resolver)
+			},
+		}
+	}
+	return ec
+}
+
+// isDisposable reports whether the domain or one of its parent domains is listed
+func (ec *EmailChecker) isDisposable(domain string) bool {
+	var fromFile map[string]bool
+	if ec.disposableFile != nil {
+		fromFile = ec.disposableFile.Get()
+	}
+	for {
+		if ec.disposable[domain] || fromFile[domain] {
+			return true
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found || !strings.Contains(parent, ".") {
+			return false
+		}
+		domain = parent
+	}
+}
+
+// parseEmail checks the syntax of a bare email address and returns its domain
+func parseEmail(value string) (string, error) {
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value || addr.Name != "" {
+		// the address is left out, reasons are logged and stored
+		return "", errors.New("invalid email address")
+	}
+	_, domain, _ := strings.Cut(addr.Address, "@")
+	domain = strings.ToLower(domain)
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, "[") {
+		return "", fmt.Errorf("invalid email domain %q", domain)
+	}
+	return domain, nil
+}
+
+// hasMailServer reports whether the domain accepts mail, from its MX records
+// or, without any, its address records. DNS failures are not held against
+// the submission.
+func (ec *EmailChecker) hasMailServer(domain string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ec.timeout)
+	defer cancel()
+
+	mxs, err := ec.resolver.LookupMX(ctx, domain)
+	if err == nil && len(mxs) > 0 {
+		if len(mxs) == 1 && mxs[0].Host == "." {
+			return false, fmt.Errorf("domain %q does not accept mail", domain)
+		}
+		return true, nil
+	}
+	var dnsErr *net.DNSError
+	if err != nil && (!errors.As(err, &dnsErr) || !dnsErr.IsNotFound) {
+		slog.Warn("MX lookup failed:", slog.String("domain", domain), slog.Any("error", err))
+		return true, nil
+	}
+	addrs, err := ec.resolver.LookupHost(ctx, domain)
+	if err == nil && len(addrs) > 0 {
+		return true, nil
+	}
+	if err != nil && (!errors.As(err, &dnsErr) || !dnsErr.IsNotFound) {
+		slog.Warn("Address lookup failed:", slog.String("domain", domain), slog.Any("error", err))
+		return true, nil
+	}
+	return false, fmt.Errorf("domain %q has no mail server", domain)
+}
+
+func (c *Check) email(sub FormSubmission, fh FormHandler) (bool, error) {
+	cfg := sub.FormCfg.EmailCheck
+	if !cfg.Enabled || fh.EmailChecker == nil || sub.FormCfg.Fields.Email == "" {
+		return true, nil
+	}
+	value := strings.TrimSpace(sub.rawField(sub.FormCfg.Fields.Email))
+	if value == "" {
+		// the field may be optional, required fields are up to the form
+		return true, nil
+	}
+	domain, err := parseEmail(value)
+	if err != nil {
+		return false, err
+	}
+	if fh.EmailChecker.isDisposable(domain) {
+		return false, fmt.Errorf("disposable email domain %q", domain)
+	}
+	if cfg.MX {
+		return fh.EmailChecker.hasMailServer(domain)
+	}
+	return true, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/microcosm-cc/bluemonday"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeDNS serves MX and A records from a map on a local UDP port and
+// answers NXDOMAIN for anything else, or SERVFAIL for A records "servfail"
+func fakeDNS(t *testing.T, mx map[string]string, a map[string]string) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var p dnsmessage.Parser
+			header, err := p.Start(buf[:n])
+			if err != nil {
+				continue
+			}
+			q, err := p.Question()
+			if err != nil {
+				continue
+			}
+			name := strings.TrimSuffix(q.Name.String(), ".")
+
+			b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, Authoritative: true})
+			b.EnableCompression()
+			b.StartQuestions()
+			b.Question(q)
+			b.StartAnswers()
+			rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}
+			_, hasMX := mx[name]
+			_, hasA := a[name]
+			switch {
+			case q.Type != dnsmessage.TypeMX && a[name] == "servfail":
+				b = dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, RCode: dnsmessage.RCodeServerFailure})
+				b.StartQuestions()
+				b.Question(q)
+			case q.Type == dnsmessage.TypeMX && hasMX:
+				b.MXResource(rh, dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName(mx[name] + ".")})
+			case q.Type == dnsmessage.TypeA && hasA:
+				ip := net.ParseIP(a[name]).To4()
+				b.AResource(rh, dnsmessage.AResource{A: [4]byte(ip)})
+			case !hasMX && !hasA:
+				b = dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, RCode: dnsmessage.RCodeNameError})
+				b.StartQuestions()
+				b.Question(q)
+			}
+			msg, err := b.Finish()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(msg, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestCheck_email(t *testing.T) {
+	resolver := fakeDNS(t,
+		map[string]string{"example.com": "mail.example.com"},
+		map[string]string{"mail.example.com": "192.0.2.25", "a-only.example": "192.0.2.26", "flaky.example": "servfail"},
+	)
+	disposable := filepath.Join(t.TempDir(), "disposable.txt")
+	os.WriteFile(disposable, []byte("# disposable\nmailinator.com\n"), 0o644)
+
+	conf := &Config{}
+	conf.Global.Email.Disposable = []string{"trashmail.example"}
+	conf.Global.Email.DisposableFile = disposable
+	conf.Global.Email.Resolver = resolver
+	fh := &FormHandler{Config: conf, EmailChecker: NewEmailChecker(conf)}
+
+	formCfg := FormConfig{EmailCheck: EmailCheckConfig{Enabled: true, MX: true}}
+	formCfg.Fields.Email = "email"
+	c := &Check{}
+
+	tests := []struct {
+		email    string
+		expected bool
+	}{
+		{"ann@example.com", true},
+		{"ann@a-only.example", true},
+		{"ann@nowhere.example", false},
+		{"ann@flaky.example", true},
+		{"", true},
+		{"not an email", false},
+		{"Ann <ann@example.com>", false},
+		{"ann@localhost", false},
+		{"ann@mailinator.com", false},
+		{"ann@sub.mailinator.com", false},
+		{"ann@trashmail.example", false},
+		{"o'brien@example.com", true},
+		{"tom&jerry@example.com", true},
+	}
+	p := bluemonday.StrictPolicy()
+	for _, test := range tests {
+		sub := FormSubmission{
+			FormCfg: formCfg,
+			Body:    FormBody{"email": p.Sanitize(test.email)},
+			Raw:     FormBody{"email": test.email},
+		}
+		pass, err := c.email(sub, *fh)
+		if pass != test.expected {
+			t.Errorf("%q: Expected %v, got %v (%v)", test.email, test.expected, pass, err)
+		}
+	}
+
+	// disabled
+	sub := FormSubmission{Body: FormBody{"email": "not an email"}}
+	sub.FormCfg.Fields.Email = "email"
+	if pass, err := c.email(sub, *fh); !pass {
+		t.Errorf("Expected pass when disabled, got %v", err)
+	}
+}
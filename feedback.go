@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultFeedbackExpires = 30 * 24 * time.Hour
+
+// how often expired delivered submissions are removed
+const feedbackPruneInterval = time.Hour
+
+var errInvalidFeedbackToken = errors.New("invalid feedback token")
+
+// NewFeedbackStore returns where delivered submissions are kept for feedback
+// links, or nil if feedback is disabled
+func NewFeedbackStore(conf *Config) *Quarantine {
+	cfg := conf.Global.Feedback
+	if !cfg.Enabled {
+		return nil
+	}
+	if conf.Global.BaseUrl == "" {
+		slog.Warn("Feedback links need global.baseUrl to be set")
+	}
+	dir := cfg.Dir
+	if dir == "" {
+		dir = "feedback"
+	}
+	store := &Quarantine{Dir: dir}
+	store.pruneEvery(feedbackPruneInterval, feedbackExpires(conf))
+	return store
+}
+
+func feedbackExpires(conf *Config) time.Duration {
+	if conf.Global.Feedback.Expires > 0 {
+		return conf.Global.Feedback.Expires
+	}
+	return defaultFeedbackExpires
+}
+
+func (fh *FormHandler) signFeedback(payload string) string {
+	mac := hmac.New(sha256.New, fh.Config.signingKey())
+	mac.Write([]byte("feedback\x00" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// feedbackToken signs the form and id of a delivered submission for links
+// that are valid until expires
+func (fh *FormHandler) feedbackToken(form string, sid string, expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(form)) + "." + sid + "." + strconv.FormatInt(expires.Unix(), 10)
+	return payload + "." + fh.signFeedback(payload)
+}
+
+// parseFeedbackToken returns the form and submission id of a valid token
+func (fh *FormHandler) parseFeedbackToken(token string, now time.Time) (string, string, error) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return "", "", errInvalidFeedbackToken
+	}
+	payload, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(fh.signFeedback(payload)), []byte(sig)) {
+		return "", "", errInvalidFeedbackToken
+	}
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return "", "", errInvalidFeedbackToken
+	}
+	form, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", "", errInvalidFeedbackToken
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", "", errInvalidFeedbackToken
+	}
+	if now.Unix() > expires {
+		return "", "", errors.New("feedback link expired")
+	}
+	return string(form), parts[1], nil
+}
+
+// keepForFeedback stores a submission that is about to be delivered and
+// returns the URL of its feedback links, or "" if feedback is disabled
+func (fh *FormHandler) keepForFeedback(sub FormSubmission) string {
+	if fh.Delivered == nil {
+		return ""
+	}
+	sid, err := fh.Delivered.Store(sub, SpamResult{})
+	if err != nil {
+		slog.Error("Failed to store submission for feedback:", slog.Any("error", err))
+		return ""
+	}
+	expires := time.Now().Add(feedbackExpires(fh.Config))
+	return fh.Config.Global.BaseUrl + "/feedback/" + fh.feedbackToken(sub.Id, sid, expires)
+}
+
+// applyFeedback teaches the classifier and IP reputation that a submission
+// was spam or ham
+func (fh *FormHandler) applyFeedback(record QuarantinedSubmission, spam bool, actor string) {
+	if fh.Classifier != nil {
+		if err := fh.train(submissionText(record.Body, fh.Config.Forms[record.Form]), spam); err != nil {
+			slog.Error("Failed to train classifier:", slog.Any("error", err))
+		}
+	}
+	if fh.Reputation != nil {
+		if err := fh.Reputation.Record(record.UserIP, spam, time.Now()); err != nil {
+			slog.Error("Failed to save IP reputation:", slog.Any("error", err))
+		}
+	}
+	verdict := "ham"
+	if spam {
+		verdict = "spam"
+	}
+	slog.Info("Feedback recorded:",
+		slog.String("form", record.Form),
+		slog.String("id", record.Id),
+		slog.String("verdict", verdict),
+		slog.String("actor", actor),
+	)
+}
+
+var feedbackPage = template.Must(template.New("feedback").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>fohago</title></head>
+<body>
+{{if .Done}}<p>Thanks, the submission was marked as {{.Label}}.</p>
+{{else}}<form method="post"><p>Mark this {{.Form}} submission as {{.Label}}?</p><button type="submit">Mark as {{.Label}}</button></form>
+{{end}}</body>
+</html>
+`))
+
+// handleFeedback serves the links in delivered emails. GET shows a
+// confirmation so that link scanners in mail clients don't trigger it,
+// POST applies the verdict.
+func (fh *FormHandler) handleFeedback(w http.ResponseWriter, r *http.Request) {
+	verdict := r.PathValue("verdict")
+	if fh.Delivered == nil || (verdict != "spam" && verdict != "ham") {
+		http.NotFound(w, r)
+		return
+	}
+	form, sid, err := fh.parseFeedbackToken(r.PathValue("token"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	// a POST takes the submission so concurrent clicks apply the feedback once
+	load := fh.Delivered.Load
+	if r.Method == http.MethodPost {
+		load = fh.Delivered.Take
+	}
+	record, err := load(form, sid)
+	if err != nil {
+		http.Error(w, "This submission has already been marked or has expired", http.StatusGone)
+		return
+	}
+
+	label := map[string]string{"spam": "spam", "ham": "not spam"}[verdict]
+	page := struct {
+		Form  string
+		Label string
+		Done  bool
+	}{Form: form, Label: label}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodPost {
+		fh.applyFeedback(record, verdict == "spam", "email:"+fh.Config.Forms[form].Mail.Recipient)
+		page.Done = true
+	}
+	feedbackPage.Execute(w, page)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lkhrs/fohago/antispam"
+)
+
+func TestFormHandler_feedbackToken(t *testing.T) {
+	conf := &Config{}
+	conf.Global.SecretKey = "secret"
+	fh := &FormHandler{Config: conf}
+	now := time.Now()
+	token := fh.feedbackToken("contact.us", "abc123", now.Add(time.Hour))
+
+	form, sid, err := fh.parseFeedbackToken(token, now)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if form != "contact.us" || sid != "abc123" {
+		t.Errorf("Expected contact.us and abc123, got %v and %v", form, sid)
+	}
+	if _, _, err := fh.parseFeedbackToken(token, now.Add(2*time.Hour)); err == nil {
+		t.Error("Expected an error for an expired token")
+	}
+	tampered := strings.Replace(token, "abc123", "abc124", 1)
+	if _, _, err := fh.parseFeedbackToken(tampered, now); err != errInvalidFeedbackToken {
+		t.Errorf("Expected %v, got %v", errInvalidFeedbackToken, err)
+	}
+}
+
+func TestFormHandler_handleFeedback(t *testing.T) {
+	conf := &Config{Forms: map[string]FormConfig{"contact": {}}}
+	conf.Global.SecretKey = "secret"
+	conf.Global.Bayes.File = filepath.Join(t.TempDir(), "bayes.json")
+	conf.Global.Reputation.File = filepath.Join(t.TempDir(), "reputation.json")
+	conf.Global.BaseUrl = "https://forms.example.com"
+	fh := &FormHandler{
+		Config:     conf,
+		Delivered:  &Quarantine{Dir: t.TempDir()},
+		Classifier: antispam.NewClassifier(),
+		Reputation: NewReputation(conf),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /feedback/{token}/{verdict}", fh.handleFeedback)
+	mux.HandleFunc("POST /feedback/{token}/{verdict}", fh.handleFeedback)
+
+	url := fh.keepForFeedback(FormSubmission{Id: "contact", Body: FormBody{"message": "cheap seo"}, UserIP: "192.0.2.1"})
+	path, found := strings.CutPrefix(url, "https://forms.example.com")
+	if !found {
+		t.Fatalf("Expected a feedback URL under the base URL, got %v", url)
+	}
+	request := func(method string, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	// link scanners opening the link must not apply the verdict
+	if w := request("GET", path+"/spam"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `method="post"`) {
+		t.Errorf("Expected a confirmation form, got %v %v", w.Code, w.Body.String())
+	}
+	if spam, _ := fh.Classifier.Trained(); spam != 0 {
+		t.Errorf("Expected no training from GET, got %v spam", spam)
+	}
+
+	if w := request("POST", path+"/spam"); w.Code != http.StatusOK {
+		t.Errorf("Expected %v, got %v", http.StatusOK, w.Code)
+	}
+	if spam, _ := fh.Classifier.Trained(); spam != 1 {
+		t.Errorf("Expected 1 spam, got %v", spam)
+	}
+	if spam, _ := fh.Reputation.Counts("192.0.2.1"); spam != 1 {
+		t.Errorf("Expected the IP to be reported once, got %v", spam)
+	}
+	if w := request("POST", path+"/ham"); w.Code != http.StatusGone {
+		t.Errorf("Expected %v once marked, got %v", http.StatusGone, w.Code)
+	}
+	if w := request("POST", "/feedback/bogus/spam"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected %v for an invalid token, got %v", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestFormHandler_handleFeedbackConcurrent(t *testing.T) {
+	conf := &Config{Forms: map[string]FormConfig{"contact": {}}}
+	conf.Global.SecretKey = "secret"
+	conf.Global.Bayes.File = filepath.Join(t.TempDir(), "bayes.json")
+	conf.Global.BaseUrl = "https://forms.example.com"
+	fh := &FormHandler{
+		Config:     conf,
+		Delivered:  &Quarantine{Dir: t.TempDir()},
+		Classifier: antispam.NewClassifier(),
+	}
+	url := fh.keepForFeedback(FormSubmission{Id: "contact", Body: FormBody{"message": "cheap seo"}})
+	path, _ := strings.CutPrefix(url, "https://forms.example.com")
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /feedback/{token}/{verdict}", fh.handleFeedback)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", path+"/spam", nil))
+		}()
+	}
+	wg.Wait()
+	if spam, _ := fh.Classifier.Trained(); spam != 1 {
+		t.Errorf("Expected the feedback to be applied once, got %v", spam)
+	}
+}
+
+func TestFormHandler_CloseStopsTickers(t *testing.T) {
+	conf := &Config{}
+	conf.Global.RateLimit.Backend = "file"
+	conf.Global.RateLimit.File = filepath.Join(t.TempDir(), "ratelimit.json")
+	conf.Global.Feedback.Enabled = true
+	conf.Global.Feedback.Dir = t.TempDir()
+	conf.Global.BaseUrl = "https://forms.example.com"
+	fh, err := NewFormHandler(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fh.Close(t.Context()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, stop := range []chan struct{}{fh.RateLimiter.stop, fh.Delivered.stop} {
+		select {
+		case <-stop:
+		default:
+			t.Error("Expected the ticker to be stopped")
+		}
+	}
+}
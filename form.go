@@ -1,17 +1,39 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
-	"net"
 	"net/http"
-	"strings"
+	"net/netip"
+	"time"
 
+	"github.com/lkhrs/fohago/antispam"
+	"github.com/lkhrs/fohago/middleware"
 	"github.com/microcosm-cc/bluemonday"
 )
 
 type FormHandler struct {
 	Config         *Config
 	FormSubmission FormSubmission
+	RateLimiter    *RateLimiter
+	TrustedProxies []netip.Prefix
+	// ForwardedHeader is the header trusted proxies set to the client IP
+	ForwardedHeader string
+	IPFilter        *IPFilter
+	Quarantine      *Quarantine
+	Replay          *antispam.ReplayCache
+	Classifier      *antispam.Classifier
+	EmailChecker    *EmailChecker
+	Dedup           *antispam.ReplayCache
+	GeoIP           *GeoIP
+	Reputation      *Reputation
+	// Delivered keeps delivered submissions for feedback links
+	Delivered     *Quarantine
+	BlocklistFile *listFile[[]string]
+	// Mail delivers submissions in the background when the queue is enabled
+	Mail *MailQueue
 }
 
 type FormSubmission struct {
@@ -21,22 +43,97 @@ type FormSubmission struct {
 	UserAgent string
 	UserIP    string
 	Referrer  string
+	// Raw holds the submitted values before sanitizing
+	Raw FormBody
+	// IdempotencyKey is sent by clients to mark retries of the same submission
+	IdempotencyKey string
+	// Country is the ISO code of the client IP, if a GeoIP database is configured
+	Country string
+	// FeedbackURL is the base of the "mark as spam" and "not spam" links in the email
+	FeedbackURL string
+	// RequestID is the X-Request-ID of the request that submitted the form
+	RequestID string
 }
 
-func NewFormHandler(conf *Config) *FormHandler {
-	fh := &FormHandler{Config: conf}
-	return fh
+// rawField returns the submitted value of a field before sanitizing, which
+// escapes characters like ' and & that are valid in e.g. email addresses
+func (sub FormSubmission) rawField(name string) string {
+	if sub.Raw == nil {
+		return sub.Body[name]
+	}
+	return sub.Raw[name]
+}
+
+// logger returns the default logger with the form id, request id and client
+// IP of the submission
+func (sub FormSubmission) logger() *slog.Logger {
+	attrs := []any{slog.String("form", sub.Id)}
+	if sub.RequestID != "" {
+		attrs = append(attrs, slog.String("request_id", sub.RequestID))
+	}
+	if sub.UserIP != "" {
+		attrs = append(attrs, slog.String("ip", sub.UserIP))
+	}
+	return slog.With(attrs...)
+}
+
+func NewFormHandler(conf *Config) (*FormHandler, error) {
+	trusted, err := parsePrefixes(conf.Global.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+	}
+	header, err := forwardedHeader(conf.Global.ForwardedHeader)
+	if err != nil {
+		return nil, err
+	}
+	for id, form := range conf.Forms {
+		if _, err := scriptTables(form.Heuristics.Scripts); err != nil {
+			return nil, fmt.Errorf("form %s: heuristics: %w", id, err)
+		}
+	}
+	ipFilter, err := NewIPFilter(conf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP filter: %w", err)
+	}
+	classifier, err := loadClassifier(conf)
+	if err != nil {
+		return nil, err
+	}
+	fh := &FormHandler{
+		Config:          conf,
+		RateLimiter:     NewRateLimiter(conf),
+		TrustedProxies:  trusted,
+		ForwardedHeader: header,
+		IPFilter:        ipFilter,
+		Quarantine:      NewQuarantine(conf),
+		Replay:          antispam.NewReplayCache(),
+		Classifier:      classifier,
+		EmailChecker:    NewEmailChecker(conf),
+		Dedup:           antispam.NewReplayCache(),
+		GeoIP:           NewGeoIP(conf),
+		Reputation:      NewReputation(conf),
+		Delivered:       NewFeedbackStore(conf),
+	}
+	fh.Mail = NewMailQueue(conf, fh.sendMail, fh.deliveryFailed)
+	if conf.Global.BlocklistFile != "" {
+		fh.BlocklistFile = newBlocklistFile(conf.Global.BlocklistFile)
+	}
+	return fh, nil
 }
 
 func (fh *FormHandler) handleFormSubmission(w http.ResponseWriter, r *http.Request) {
-	submission := fh.process(w, r)
-	if !fh.checkSpam(submission) {
-		http.Error(w, "Spam detected", http.StatusBadRequest)
-		return
+	if formCfg, exists := fh.Config.Forms[r.PathValue("id")]; exists {
+		r.Body = http.MaxBytesReader(w, r.Body, fh.Config.limitsFor(formCfg).MaxBodySize)
+	}
+	submission, outcome, err := fh.submit(r)
+	if err != nil {
+		outcome = string(failureKind(err))
 	}
-	success := fh.sendMail(submission)
-	if !success {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	submissionsTotal.Inc(fh.Config.formLabel(submission.Id), outcome)
+	logSubmission(submission, outcome, err)
+	if err != nil {
+		fh.writeSubmissionError(w, r, submission, err)
+		return
 	}
 	successRedirect := fh.Config.Global.BaseUrl + "/success.html"
 	if submission.FormCfg.Redirects.Success != "" {
@@ -45,55 +142,146 @@ func (fh *FormHandler) handleFormSubmission(w http.ResponseWriter, r *http.Reque
 	http.Redirect(w, r, successRedirect, http.StatusFound)
 }
 
-func (fh *FormHandler) getClientIP(r *http.Request) string {
-	ip := r.Header.Get("X-Forwarded-For")
-	if ip != "" {
-		return strings.Split(ip, ",")[0]
+// submit runs a submission through parsing, deduplication, rate limiting,
+// the spam checks and delivery, and returns the outcome of submissions that
+// get the success response. Errors are a *SubmissionError.
+func (fh *FormHandler) submit(r *http.Request) (FormSubmission, string, error) {
+	submission, err := fh.process(r)
+	if err != nil {
+		return submission, "", err
 	}
-	ip = r.Header.Get("X-Real-IP")
-	if ip != "" {
-		return ip
+	// duplicates are claimed before the spam checks, which would reject the
+	// single-use tokens they replay
+	if !fh.claimSubmission(submission) {
+		return submission, outcomeDuplicate, nil
 	}
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
+	outcome, err := fh.deliver(submission)
+	if err != nil || outcome != outcomeAccepted {
+		fh.releaseSubmission(submission)
+	}
+	return submission, outcome, err
+}
+
+// deliver sends a claimed submission unless it is rate limited or spam
+func (fh *FormHandler) deliver(submission FormSubmission) (string, error) {
+	if fh.RateLimiter != nil {
+		allowed, wait := fh.RateLimiter.Allow(submission.Id, submission.FormCfg, submission.UserIP, time.Now())
+		if !allowed {
+			return "", &SubmissionError{Kind: errRateLimited, RetryAfter: wait}
+		}
+	}
+	result := fh.checkSpam(submission)
+	switch result.Verdict {
+	case spamReject:
+		return "", submissionError(errSpam, nil)
+	case spamQuarantine:
+		if err := fh.quarantine(submission, result); err != nil {
+			return "", submissionError(errInternal, err)
+		}
+		return outcomeQuarantined, nil
+	}
+	submission.FeedbackURL = fh.keepForFeedback(submission)
+	deliver := fh.sendMail
+	if fh.Mail != nil {
+		deliver = fh.Mail.Enqueue
 	}
-	return ip
+	if err := deliver(submission); err != nil {
+		return "", submissionError(errDeliveryFailed, err)
+	}
+	return outcomeAccepted, nil
 }
 
 // process parses the form submission and returns a FormSubmission struct
-func (fh *FormHandler) process(w http.ResponseWriter, r *http.Request) FormSubmission {
-	id := r.URL.Path[1:]
+func (fh *FormHandler) process(r *http.Request) (FormSubmission, error) {
+	id := r.PathValue("id")
+	ip := fh.getClientIP(r)
+	middleware.SetClientIP(r.Context(), ip)
 	formCfg, exists := fh.Config.Forms[id]
 	if !exists {
-		http.NotFound(w, r)
+		return FormSubmission{Id: id, RequestID: middleware.RequestID(r.Context())}, submissionError(errUnknownForm, nil)
 	}
-
-	if err := r.ParseForm(); err != nil {
-		slog.Error("Failed to parse form:", slog.Any("error", err))
-		http.Error(w, "Failed to parse form", http.StatusInternalServerError)
+	if err := parseForm(r, fh.Config.limitsFor(formCfg)); err != nil {
+		return FormSubmission{Id: id, FormCfg: formCfg, RequestID: middleware.RequestID(r.Context())}, err
 	}
 
 	fields := make(FormBody)
+	raw := make(FormBody)
 	p := bluemonday.StrictPolicy()
 	for k, v := range r.Form {
+		raw[k] = v[0]
 		fields[k] = p.Sanitize(v[0])
 	}
 
 	submission := FormSubmission{
 		Id:        id,
 		Body:      fields,
+		Raw:       raw,
 		FormCfg:   formCfg,
 		UserAgent: r.UserAgent(),
-		UserIP:    fh.getClientIP(r),
+		UserIP:    ip,
 		Referrer:  r.Referer(),
+		RequestID: middleware.RequestID(r.Context()),
+	}
+	submission.Country = fh.GeoIP.Country(submission.UserIP)
+	submission.IdempotencyKey = r.Header.Get("Idempotency-Key")
+	if key := fields[formCfg.Dedup.field()]; key != "" {
+		submission.IdempotencyKey = key
 	}
 
-	return submission
+	return submission, nil
 }
 
 // sendMail sends the form submission as an email
-// returns true if the email was sent successfully, false otherwise
-func (fh *FormHandler) sendMail(sub FormSubmission) bool {
-	return buildAndSend(fh.Config, sub) == nil
+func (fh *FormHandler) sendMail(sub FormSubmission) error {
+	return buildAndSend(fh.Config, sub)
+}
+
+// deliveryFailed quarantines a queued submission that could not be
+// delivered, so it can be sent again from the admin API, and releases its
+// dedup claim so the visitor can retry
+func (fh *FormHandler) deliveryFailed(sub FormSubmission, err error) {
+	fh.releaseSubmission(sub)
+	result := SpamResult{Reasons: []SpamReason{{Check: "delivery", Reason: err.Error()}}}
+	id, storeErr := fh.Quarantine.Store(sub, result)
+	if storeErr != nil {
+		sub.logger().Error("Submission lost after failed delivery:", slog.Any("error", storeErr))
+		return
+	}
+	sub.logger().Error("Submission quarantined after failed delivery:", slog.String("id", id), slog.Any("error", err))
+}
+
+// Close delivers the queued mail and saves state, ctx limits how long it waits
+func (fh *FormHandler) Close(ctx context.Context) error {
+	var err error
+	if fh.Mail != nil {
+		if err = fh.Mail.Close(ctx); err != nil {
+			slog.Error("Mail queue not drained, undelivered submissions were quarantined:", slog.Any("error", err))
+		}
+	}
+	if fh.RateLimiter != nil {
+		err = errors.Join(err, fh.RateLimiter.Close())
+	}
+	if fh.Delivered != nil {
+		fh.Delivered.Close()
+	}
+	return err
+}
+
+// quarantine keeps a likely spam submission for review instead of dropping it,
+// either on disk or delivered with a [SPAM] subject tag
+func (fh *FormHandler) quarantine(sub FormSubmission, result SpamResult) error {
+	if sub.FormCfg.Spam.Quarantine == "email" {
+		sub.FormCfg.Mail.Subject = "[SPAM] " + sub.FormCfg.Mail.Subject
+		sub.FeedbackURL = fh.keepForFeedback(sub)
+		return buildAndSend(fh.Config, sub)
+	}
+	id, err := fh.Quarantine.Store(sub, result)
+	if err != nil {
+		return err
+	}
+	sub.logger().Info("Submission quarantined:",
+		slog.String("id", id),
+		slog.Float64("score", result.Score),
+	)
+	return nil
 }
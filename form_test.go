@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lkhrs/fohago/middleware"
+)
+
+func newFormTestHandler(t *testing.T) (*FormHandler, *http.ServeMux) {
+	// an SMTP port nothing listens on, so delivery fails fast
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	contact := FormConfig{}
+	contact.Fields.Honeypot = "website"
+	redirected := contact
+	redirected.Redirects.Error = "https://example.com/error.html"
+	conf := &Config{Forms: map[string]FormConfig{"contact": contact, "redirected": redirected}}
+	conf.Smtp.Host = "127.0.0.1"
+	conf.Smtp.Port = port
+	fh, err := NewFormHandler(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{id}", fh.handleFormSubmission)
+	return fh, mux
+}
+
+func postForm(mux *http.ServeMux, target string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+func TestFormHandler_handleFormSubmissionErrors(t *testing.T) {
+	fh, mux := newFormTestHandler(t)
+	fh.Config.Global.RateLimit.Requests = 1
+	fh.Config.Global.RateLimit.Period = time.Minute
+	fh.RateLimiter = NewRateLimiter(fh.Config)
+
+	tests := []struct {
+		name     string
+		target   string
+		body     string
+		expected int
+	}{
+		{"Unknown form", "/nope", "message=hi", http.StatusNotFound},
+		{"Malformed body", "/contact", "message=%zz", http.StatusBadRequest},
+		{"Spam", "/contact", "website=spam", http.StatusBadRequest},
+		{"Rate limited", "/contact", "message=hi", http.StatusTooManyRequests},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := postForm(mux, test.target, test.body)
+			if w.Code != test.expected {
+				t.Errorf("Expected %v, got %v", test.expected, w.Code)
+			}
+			if location := w.Header().Get("Location"); location != "" {
+				t.Errorf("Expected no redirect, got %v", location)
+			}
+			if test.expected == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+				t.Error("Expected a Retry-After header")
+			}
+		})
+	}
+}
+
+func TestFormHandler_handleFormSubmissionDeliveryFailed(t *testing.T) {
+	_, mux := newFormTestHandler(t)
+
+	w := postForm(mux, "/contact", "message=hi")
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected %v, got %v", http.StatusInternalServerError, w.Code)
+	}
+	if location := w.Header().Get("Location"); location != "" {
+		t.Errorf("Expected no redirect after a failed delivery, got %v", location)
+	}
+
+	w = postForm(mux, "/redirected", "message=hi")
+	if w.Code != http.StatusFound {
+		t.Errorf("Expected %v, got %v", http.StatusFound, w.Code)
+	}
+	if location := w.Header().Get("Location"); location != "https://example.com/error.html" {
+		t.Errorf("Expected the error redirect, got %v", location)
+	}
+}
+
+func TestSubmissionError(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := error(submissionError(errDeliveryFailed, cause))
+	if !errors.Is(err, errDeliveryFailed) {
+		t.Error("Expected the error to match its kind")
+	}
+	if errors.Is(err, errSpam) {
+		t.Error("Expected the error not to match another kind")
+	}
+	if !errors.Is(err, cause) {
+		t.Error("Expected the error to wrap its cause")
+	}
+	if failureKind(cause) != errInternal {
+		t.Errorf("Expected %v for other errors, got %v", errInternal, failureKind(cause))
+	}
+}
+
+func TestFormHandler_handleFormSubmissionLogs(t *testing.T) {
+	_, mux := newFormTestHandler(t)
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	handler := middleware.RequestIDs(mux)
+	r := httptest.NewRequest("POST", "/contact", strings.NewReader("website=spam"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set(middleware.RequestIDHeader, "req-1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	var checkLogged, outcomeLogged bool
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["form"] != "contact" || entry["request_id"] != "req-1" {
+			t.Errorf("Expected form and request id attributes, got %v", line)
+		}
+		checkLogged = checkLogged || entry["check"] == "honeypot"
+		outcomeLogged = outcomeLogged || entry["outcome"] == "spam"
+	}
+	if !checkLogged || !outcomeLogged {
+		t.Errorf("Expected the failed check and outcome to be logged, got %v", buf.String())
+	}
+}
+
+func TestFormHandler_handleFormSubmissionDuplicate(t *testing.T) {
+	fh, mux := newFormTestHandler(t)
+	fh.Config.Global.SecretKey = "secret"
+	formCfg := FormConfig{
+		FillTime: FillTimeConfig{Max: time.Hour},
+		Dedup:    DedupConfig{Window: time.Minute},
+	}
+	formCfg.Fields.Honeypot = "website"
+	fh.Config.Forms["dedup"] = formCfg
+	fh.Config.Global.Queue.Workers = 1
+	var delivered int
+	fh.Mail = NewMailQueue(fh.Config, func(FormSubmission) error {
+		delivered++
+		return nil
+	}, nil)
+
+	// a rejected submission does not keep its claim
+	token, err := fh.formToken().Issue("dedup", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := postForm(mux, "/dedup", "website=spam&message=hi&fohago-token="+token); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected %v, got %v", http.StatusBadRequest, w.Code)
+	}
+
+	// a double-click replays the single-use form token but still gets the success response
+	token, err = fh.formToken().Issue("dedup", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if w := postForm(mux, "/dedup", "message=hi&fohago-token="+token); w.Code != http.StatusFound {
+			t.Errorf("Expected %v, got %v", http.StatusFound, w.Code)
+		}
+	}
+	fh.Mail.Close(context.Background())
+	if delivered != 1 {
+		t.Errorf("Expected %v, got %v", 1, delivered)
+	}
+}
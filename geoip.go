@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lkhrs/fohago/geoip"
+)
+
+// GeoIP looks up client countries in a MaxMind DB file. The file is
+// reloaded when it changes, e.g. after a geoipupdate run.
+type GeoIP struct {
+	path    string
+	mu      sync.Mutex
+	reader  *geoip.Reader
+	modTime time.Time
+	size    int64
+	checked time.Time
+}
+
+// NewGeoIP returns nil if no database is configured
+func NewGeoIP(conf *Config) *GeoIP {
+	if conf.Global.GeoIP.Database == "" {
+		return nil
+	}
+	g := &GeoIP{path: conf.Global.GeoIP.Database}
+	g.reload(time.Now())
+	return g
+}
+
+// reload opens the database if its modification time or size changed.
+// On error the previously loaded database is kept.
+func (g *GeoIP) reload(now time.Time) {
+	g.checked = now
+	info, err := os.Stat(g.path)
+	if err != nil {
+		slog.Warn("Could not stat GeoIP database:", slog.String("path", g.path), slog.Any("error", err))
+		return
+	}
+	if info.ModTime().Equal(g.modTime) && info.Size() == g.size {
+		return
+	}
+	reader, err := geoip.Open(g.path)
+	if err != nil {
+		slog.Warn("Could not load GeoIP database:", slog.String("path", g.path), slog.Any("error", err))
+		return
+	}
+	g.reader = reader
+	g.modTime = info.ModTime()
+	g.size = info.Size()
+	slog.Info("Loaded GeoIP database:", slog.String("path", g.path), slog.String("type", reader.DatabaseType))
+}
+
+// Country returns the ISO country code of an IP, or "" if it is unknown
+func (g *GeoIP) Country(ip string) string {
+	if g == nil {
+		return ""
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	g.mu.Lock()
+	if now := time.Now(); now.Sub(g.checked) >= listReloadInterval {
+		g.reload(now)
+	}
+	reader := g.reader
+	g.mu.Unlock()
+	if reader == nil {
+		return ""
+	}
+	country, err := reader.Country(addr)
+	if err != nil {
+		slog.Warn("GeoIP lookup failed:", slog.String("ip", ip), slog.Any("error", err))
+	}
+	return country
+}
+
+func containsCountry(list []string, country string) bool {
+	return slices.ContainsFunc(list, func(c string) bool {
+		return strings.EqualFold(c, country)
+	})
+}
+
+// geoip enforces the form's country lists. Submissions from addresses that
+// are not in the database, like private networks, are not held back.
+func (c *Check) geoip(sub FormSubmission) (bool, error) {
+	cfg := sub.FormCfg.GeoIP
+	if sub.Country == "" {
+		return true, nil
+	}
+	if len(cfg.Allow) > 0 && !containsCountry(cfg.Allow, sub.Country) {
+		return false, fmt.Errorf("country %s is not allowed", sub.Country)
+	}
+	if containsCountry(cfg.Deny, sub.Country) {
+		return false, fmt.Errorf("country %s is denied", sub.Country)
+	}
+	return true, nil
+}
@@ -0,0 +1,362 @@
+// Package geoip reads MaxMind DB (MMDB) files, such as GeoLite2-Country,
+// to look up the country of an IP address.
+//
+// https://maxmind.github.io/MaxMind-DB/
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// size of the zero bytes between the search tree and the data section
+const dataSectionSeparator = 16
+
+// Reader looks up records in a MaxMind DB file held in memory
+type Reader struct {
+	buf        []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+	// DatabaseType from the metadata, e.g. "GeoLite2-Country"
+	DatabaseType string
+}
+
+// Open reads a MaxMind DB file
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(buf)
+}
+
+// FromBytes reads a MaxMind DB from memory
+func FromBytes(buf []byte) (*Reader, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, errors.New("geoip: metadata not found")
+	}
+	meta := decoder{buf: buf[i+len(metadataMarker):]}
+	value, _, err := meta.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: invalid metadata: %w", err)
+	}
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, errors.New("geoip: invalid metadata")
+	}
+
+	r := &Reader{buf: buf}
+	r.nodeCount = uintValue(m["node_count"])
+	r.recordSize = uintValue(m["record_size"])
+	r.ipVersion = uintValue(m["ip_version"])
+	r.DatabaseType, _ = m["database_type"].(string)
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("geoip: unsupported record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("geoip: unsupported IP version %d", r.ipVersion)
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(i) {
+		return nil, errors.New("geoip: search tree exceeds file size")
+	}
+	r.data = buf[treeSize+dataSectionSeparator : i]
+
+	// IPv4 addresses live under ::/96 in IPv6 databases
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for j := 0; j < 96 && node < r.nodeCount; j++ {
+			node = r.readNode(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+func uintValue(v any) uint {
+	switch n := v.(type) {
+	case uint64:
+		return uint(n)
+	case int32:
+		return uint(n)
+	}
+	return 0
+}
+
+// readNode returns the left (bit 0) or right (bit 1) record of a node
+func (r *Reader) readNode(node uint, bit uint) uint {
+	b := r.buf[node*r.recordSize/4:]
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// Lookup returns the record for an address, or nil if there is none
+func (r *Reader) Lookup(addr netip.Addr) (any, error) {
+	addr = addr.Unmap()
+	node := uint(0)
+	bits := addr.AsSlice()
+	if addr.Is4() {
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else if r.ipVersion == 4 {
+		return nil, errors.New("geoip: IPv6 lookup in an IPv4 database")
+	}
+
+	for i := 0; i < len(bits)*8 && node < r.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-i%8)) & 1
+		node = r.readNode(node, bit)
+	}
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, errors.New("geoip: invalid search tree")
+	}
+	offset := node - r.nodeCount - dataSectionSeparator
+	d := decoder{buf: r.data}
+	value, _, err := d.decode(offset)
+	return value, err
+}
+
+// Country returns the ISO 3166-1 country code of an address, falling back
+// to the country it is registered in. It returns "" if the address is unknown.
+func (r *Reader) Country(addr netip.Addr) (string, error) {
+	record, err := r.Lookup(addr)
+	if err != nil {
+		return "", err
+	}
+	m, _ := record.(map[string]any)
+	for _, key := range []string{"country", "registered_country"} {
+		country, _ := m[key].(map[string]any)
+		if code, ok := country["iso_code"].(string); ok && code != "" {
+			return code, nil
+		}
+	}
+	return "", nil
+}
+
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// maximum depth of nested maps and arrays
+const maxDepth = 32
+
+var errTruncated = errors.New("data truncated")
+
+// decoder decodes the MaxMind DB data section format
+type decoder struct {
+	buf   []byte
+	depth int
+}
+
+func (d *decoder) bytes(offset uint, n uint) ([]byte, error) {
+	if offset+n > uint(len(d.buf)) || offset+n < offset {
+		return nil, errTruncated
+	}
+	return d.buf[offset : offset+n], nil
+}
+
+func (d *decoder) byteAt(offset uint) (byte, error) {
+	b, err := d.bytes(offset, 1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// decode returns the value at offset and the offset after it
+func (d *decoder) decode(offset uint) (any, uint, error) {
+	ctrl, err := d.byteAt(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset++
+	typ := uint(ctrl >> 5)
+
+	if typ == typePointer {
+		pointer, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		// like libmaxminddb, pointers to pointers are invalid so a
+		// corrupt file can't make the decoder follow them forever
+		target, err := d.byteAt(pointer)
+		if err != nil {
+			return nil, 0, err
+		}
+		if target>>5 == typePointer {
+			return nil, 0, errors.New("pointer to a pointer")
+		}
+		value, _, err := d.decode(pointer)
+		return value, next, err
+	}
+	if typ == typeExtended {
+		ext, err := d.byteAt(offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset++
+		typ = 7 + uint(ext)
+	}
+
+	size := uint(ctrl & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		b, err := d.bytes(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
+		var extra uint
+		for _, c := range b {
+			extra = extra<<8 | uint(c)
+		}
+		switch size {
+		case 29:
+			size = 29 + extra
+		case 30:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+	return d.decodeType(typ, size, offset)
+}
+
+func (d *decoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	ss := uint(ctrl>>3) & 0x3
+	b, err := d.bytes(offset, ss+1)
+	if err != nil {
+		return 0, 0, err
+	}
+	var p uint
+	if ss < 3 {
+		p = uint(ctrl & 0x7)
+	}
+	for _, c := range b {
+		p = p<<8 | uint(c)
+	}
+	switch ss {
+	case 1:
+		p += 2048
+	case 2:
+		p += 526336
+	}
+	return p, offset + ss + 1, nil
+}
+
+func (d *decoder) decodeType(typ uint, size uint, offset uint) (any, uint, error) {
+	switch typ {
+	case typeMap, typeArray:
+		if d.depth >= maxDepth {
+			return nil, 0, errors.New("data nested too deeply")
+		}
+		d.depth++
+		defer func() { d.depth-- }()
+		if typ == typeArray {
+			values := make([]any, 0, min(size, 1024))
+			for i := uint(0); i < size; i++ {
+				value, next, err := d.decode(offset)
+				if err != nil {
+					return nil, 0, err
+				}
+				values = append(values, value)
+				offset = next
+			}
+			return values, offset, nil
+		}
+		m := make(map[string]any, min(size, 1024))
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			value, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+			offset = next
+		}
+		return m, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	b, err := d.bytes(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	next := offset + size
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes, typeUint128:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, next, nil
+	case typeInt32:
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int32(n), next, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported data type %d", typ)
+}
@@ -0,0 +1,253 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dbWriter builds a minimal MaxMind DB for tests
+type dbWriter struct {
+	ipVersion  int
+	recordSize int
+	// records of each node: -1 is empty, otherwise a child node or, with
+	// data set, an offset into the data section
+	nodes [][2]int
+	data  [][2]bool
+	buf   []byte
+	keys  map[string]int
+}
+
+func newDBWriter(ipVersion int, recordSize int) *dbWriter {
+	return &dbWriter{
+		ipVersion:  ipVersion,
+		recordSize: recordSize,
+		nodes:      [][2]int{{-1, -1}},
+		data:       [][2]bool{{}},
+		keys:       make(map[string]int),
+	}
+}
+
+func (w *dbWriter) ctrl(typ int, size int) {
+	if typ > 7 {
+		w.buf = append(w.buf, byte(size), byte(typ-7))
+		return
+	}
+	w.buf = append(w.buf, byte(typ<<5|size))
+}
+
+// key writes a map key, using a pointer for keys that were written before
+func (w *dbWriter) key(s string) {
+	if p, ok := w.keys[s]; ok {
+		w.buf = append(w.buf, byte(typePointer<<5|p>>8), byte(p))
+		return
+	}
+	w.keys[s] = len(w.buf)
+	w.str(s)
+}
+
+func (w *dbWriter) str(s string) {
+	w.ctrl(typeString, len(s))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *dbWriter) uint(typ int, n uint32) {
+	b := binary.BigEndian.AppendUint32(nil, n)
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	w.ctrl(typ, len(b))
+	w.buf = append(w.buf, b...)
+}
+
+// insert adds a network with a record like {"country": {"iso_code": code}}
+func (w *dbWriter) insert(prefix string, key string, code string) {
+	p := netip.MustParsePrefix(prefix)
+	addr := p.Addr().AsSlice()
+	bits := p.Bits()
+	if w.ipVersion == 6 && p.Addr().Is4() {
+		addr = append(make([]byte, 12), addr...)
+		bits += 96
+	}
+
+	offset := len(w.buf)
+	w.ctrl(typeMap, 1)
+	w.key(key)
+	w.ctrl(typeMap, 1)
+	w.key("iso_code")
+	w.str(code)
+
+	node := 0
+	for i := 0; i < bits; i++ {
+		bit := int(addr[i/8]>>(7-i%8)) & 1
+		if i == bits-1 {
+			w.nodes[node][bit] = offset
+			w.data[node][bit] = true
+			break
+		}
+		if w.nodes[node][bit] < 0 {
+			w.nodes = append(w.nodes, [2]int{-1, -1})
+			w.data = append(w.data, [2]bool{})
+			w.nodes[node][bit] = len(w.nodes) - 1
+		}
+		node = w.nodes[node][bit]
+	}
+}
+
+func (w *dbWriter) bytes() []byte {
+	count := len(w.nodes)
+	var tree []byte
+	for i, node := range w.nodes {
+		var records [2]uint32
+		for bit, record := range node {
+			switch {
+			case record < 0:
+				records[bit] = uint32(count)
+			case w.data[i][bit]:
+				records[bit] = uint32(count + dataSectionSeparator + record)
+			default:
+				records[bit] = uint32(record)
+			}
+		}
+		left, right := records[0], records[1]
+		switch w.recordSize {
+		case 24:
+			tree = append(tree, byte(left>>16), byte(left>>8), byte(left),
+				byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			tree = append(tree, byte(left>>16), byte(left>>8), byte(left),
+				byte(left>>20&0xF0)|byte(right>>24&0x0F),
+				byte(right>>16), byte(right>>8), byte(right))
+		default:
+			tree = binary.BigEndian.AppendUint32(tree, left)
+			tree = binary.BigEndian.AppendUint32(tree, right)
+		}
+	}
+
+	out := append(tree, make([]byte, dataSectionSeparator)...)
+	out = append(out, w.buf...)
+	out = append(out, metadataMarker...)
+
+	meta := &dbWriter{keys: make(map[string]int)}
+	meta.ctrl(typeMap, 5)
+	meta.key("node_count")
+	meta.uint(typeUint32, uint32(count))
+	meta.key("record_size")
+	meta.uint(typeUint16, uint32(w.recordSize))
+	meta.key("ip_version")
+	meta.uint(typeUint16, uint32(w.ipVersion))
+	meta.key("database_type")
+	meta.str("Test-Country")
+	meta.key("binary_format_major_version")
+	meta.uint(typeUint16, 2)
+	return append(out, meta.buf...)
+}
+
+func testDB(ipVersion int, recordSize int) []byte {
+	w := newDBWriter(ipVersion, recordSize)
+	w.insert("192.0.2.0/24", "country", "DE")
+	w.insert("203.0.113.0/25", "registered_country", "US")
+	if ipVersion == 6 {
+		w.insert("2001:db8::/32", "country", "FR")
+	}
+	return w.bytes()
+}
+
+func TestReader_Country(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected string
+	}{
+		{"192.0.2.7", "DE"},
+		{"192.0.2.255", "DE"},
+		{"203.0.113.1", "US"},
+		{"203.0.113.200", ""},
+		{"198.51.100.1", ""},
+	}
+	for _, ipVersion := range []int{4, 6} {
+		for _, recordSize := range []int{24, 28, 32} {
+			r, err := FromBytes(testDB(ipVersion, recordSize))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if r.DatabaseType != "Test-Country" {
+				t.Errorf("Expected database type Test-Country, got %v", r.DatabaseType)
+			}
+			for _, tc := range tests {
+				country, err := r.Country(netip.MustParseAddr(tc.ip))
+				if err != nil {
+					t.Errorf("IPv%d/%d %s: Expected no error, got %v", ipVersion, recordSize, tc.ip, err)
+				}
+				if country != tc.expected {
+					t.Errorf("IPv%d/%d %s: Expected %q, got %q", ipVersion, recordSize, tc.ip, tc.expected, country)
+				}
+			}
+		}
+	}
+}
+
+func TestReader_CountryIPv6(t *testing.T) {
+	r, err := FromBytes(testDB(6, 28))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	tests := map[string]string{
+		"2001:db8::1":      "FR",
+		"2001:db9::1":      "",
+		"::ffff:192.0.2.1": "DE",
+	}
+	for ip, expected := range tests {
+		country, err := r.Country(netip.MustParseAddr(ip))
+		if err != nil {
+			t.Errorf("%s: Expected no error, got %v", ip, err)
+		}
+		if country != expected {
+			t.Errorf("%s: Expected %q, got %q", ip, expected, country)
+		}
+	}
+
+	r, err = FromBytes(testDB(4, 24))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := r.Country(netip.MustParseAddr("2001:db8::1")); err == nil {
+		t.Error("Expected an error for an IPv6 lookup in an IPv4 database")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, testDB(6, 24), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if country, _ := r.Country(netip.MustParseAddr("192.0.2.1")); country != "DE" {
+		t.Errorf("Expected DE, got %q", country)
+	}
+
+	if _, err := FromBytes([]byte("not a database")); err == nil {
+		t.Error("Expected an error for a file without metadata")
+	}
+}
+
+func TestDecoder_pointerLoop(t *testing.T) {
+	tests := map[string][]byte{
+		// a pointer to itself
+		"Self": {0x20, 0x00},
+		// a pointer to a pointer back to the first one
+		"Chain": {0x20, 0x02, 0x20, 0x00},
+		// a map whose value points back to the map
+		"Map": {0xe1, 0x41, 'k', 0x20, 0x00},
+	}
+	for name, buf := range tests {
+		d := &decoder{buf: buf}
+		if _, _, err := d.decode(0); err == nil {
+			t.Errorf("%s: Expected an error, got nil", name)
+		}
+	}
+}
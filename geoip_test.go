@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCheck_geoip(t *testing.T) {
+	c := &Check{}
+	tests := []struct {
+		name     string
+		cfg      GeoIPConfig
+		country  string
+		expected bool
+	}{
+		{"No lists", GeoIPConfig{}, "DE", true},
+		{"Allowed", GeoIPConfig{Allow: []string{"DE", "AT"}}, "DE", true},
+		{"Allowed lowercase", GeoIPConfig{Allow: []string{"de"}}, "DE", true},
+		{"Not allowed", GeoIPConfig{Allow: []string{"DE"}}, "US", false},
+		{"Denied", GeoIPConfig{Deny: []string{"US"}}, "US", false},
+		{"Not denied", GeoIPConfig{Deny: []string{"US"}}, "DE", true},
+		{"Unknown country", GeoIPConfig{Allow: []string{"DE"}}, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sub := FormSubmission{FormCfg: FormConfig{GeoIP: test.cfg}, Country: test.country}
+			pass, err := c.geoip(sub)
+			if pass != test.expected {
+				t.Errorf("Expected %v, got %v (%v)", test.expected, pass, err)
+			}
+			if !pass && err == nil {
+				t.Error("Expected an error explaining the failure")
+			}
+		})
+	}
+}
+
+func TestGeoIP_CountryWithoutDatabase(t *testing.T) {
+	var g *GeoIP
+	if country := g.Country("192.0.2.1"); country != "" {
+		t.Errorf("Expected no country, got %q", country)
+	}
+	g = NewGeoIP(&Config{})
+	if g != nil {
+		t.Errorf("Expected nil without a database, got %v", g)
+	}
+}
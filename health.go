@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// paths of the probe and metrics endpoints, left out of the access log by default
+var probePaths = []string{"/healthz", "/readyz", "/version", "/metrics"}
+
+const (
+	smtpProbeTimeout = 2 * time.Second
+	// how long an SMTP probe result is reused, so probes don't flood the server
+	smtpProbeCacheTime = 10 * time.Second
+)
+
+// smtpProbe remembers the result of the last SMTP connection check
+type smtpProbe struct {
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+var smtpStatus smtpProbe
+
+func (p *smtpProbe) check(conf *Config, now time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if now.Sub(p.checked) < smtpProbeCacheTime {
+		return p.err
+	}
+	p.checked = now
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(conf.Smtp.Host, strconv.Itoa(conf.Smtp.Port)), smtpProbeTimeout)
+	if err == nil {
+		conn.Close()
+	}
+	p.err = err
+	return err
+}
+
+// checkTemplates parses the default template and the forms' own templates
+func checkTemplates(conf *Config) error {
+	if _, err := template.ParseFiles("forms/default.html"); err != nil {
+		return err
+	}
+	for id := range conf.Forms {
+		_, err := template.ParseFiles(fmt.Sprintf("forms/%s.html", id))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleHealth reports that the process is up
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReady reports whether fohago can accept submissions: the config is
+// valid, the templates parse, the SMTP server accepts connections and the
+// mail queue has room. The response only says which checks failed, the
+// errors are logged since they name internal hosts.
+func (fh *FormHandler) handleReady(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{}
+	ready := true
+	report := func(name string, err error) {
+		checks[name] = "ok"
+		if err != nil {
+			slog.Warn("Readiness check failed:", slog.String("check", name), slog.Any("error", err))
+			checks[name] = "fail"
+			ready = false
+		}
+	}
+	report("config", fh.Config.check())
+	report("templates", checkTemplates(fh.Config))
+	report("smtp", smtpStatus.check(fh.Config, time.Now()))
+	if fh.Mail != nil {
+		report("queue", fh.Mail.ready())
+	}
+
+	status, code := "ok", http.StatusOK
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, code, map[string]any{"status": status, "checks": checks})
+}
+
+// handleVersion returns the build information of the binary
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		http.Error(w, "Build information not available", http.StatusNotFound)
+		return
+	}
+	version := map[string]string{
+		"version": info.Main.Version,
+		"go":      info.GoVersion,
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			version["revision"] = setting.Value
+		case "vcs.time":
+			version["time"] = setting.Value
+		case "vcs.modified":
+			version["modified"] = setting.Value
+		}
+	}
+	writeJSON(w, http.StatusOK, version)
+}
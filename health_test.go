@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandleHealth(t *testing.T) {
+	w := httptest.NewRecorder()
+	handleHealth(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected %v, got %v", http.StatusOK, w.Code)
+	}
+}
+
+func TestFormHandler_handleReady(t *testing.T) {
+	smtp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer smtp.Close()
+
+	conf := &Config{Forms: map[string]FormConfig{"contact": {}}}
+	conf.Global.Port = 8080
+	conf.Smtp.Host = "127.0.0.1"
+	conf.Smtp.Port = smtp.Addr().(*net.TCPAddr).Port
+	conf.Global.Queue.Workers = 1
+	fh := &FormHandler{Config: conf}
+	fh.Mail = NewMailQueue(conf, func(FormSubmission) error { return nil }, nil)
+
+	ready := func() (int, map[string]string) {
+		smtpStatus.checked = time.Time{}
+		w := httptest.NewRecorder()
+		fh.handleReady(w, httptest.NewRequest("GET", "/readyz", nil))
+		var body struct {
+			Checks map[string]string `json:"checks"`
+		}
+		json.NewDecoder(w.Body).Decode(&body)
+		return w.Code, body.Checks
+	}
+
+	if code, checks := ready(); code != http.StatusOK {
+		t.Errorf("Expected %v, got %v %v", http.StatusOK, code, checks)
+	}
+
+	smtp.Close()
+	fh.Mail.Close(t.Context())
+	code, checks := ready()
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("Expected %v, got %v", http.StatusServiceUnavailable, code)
+	}
+	if checks["smtp"] != "fail" || checks["queue"] != "fail" || checks["config"] != "ok" || checks["templates"] != "ok" {
+		t.Errorf("Expected smtp and queue to fail, got %v", checks)
+	}
+}
+
+func TestHandleVersion(t *testing.T) {
+	w := httptest.NewRecorder()
+	handleVersion(w, httptest.NewRequest("GET", "/version", nil))
+	var version map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&version); err != nil {
+		t.Fatalf("Expected JSON, got %v", err)
+	}
+	if version["go"] == "" {
+		t.Errorf("Expected the Go version, got %v", version)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	linkPattern   = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"'\]]+`)
+	markupPattern = regexp.MustCompile(`(?i)\[/?(?:url|link)[=\]]|<a\s[^>]*href`)
+)
+
+// minimum number of letters before the uppercase ratio is checked
+const minUppercaseLetters = 20
+
+// countLinks counts URLs in a text
+func countLinks(text string) int {
+	return len(linkPattern.FindAllStringIndex(text, -1))
+}
+
+// hasMarkupLinks reports whether a text contains BBCode or HTML links
+func hasMarkupLinks(text string) bool {
+	return markupPattern.MatchString(text)
+}
+
+// disallowedScript returns the first letter not written in one of the allowed scripts
+func disallowedScript(text string, allowed []*unicode.RangeTable) (rune, bool) {
+	for _, r := range text {
+		if !unicode.IsLetter(r) || unicode.In(r, unicode.Common, unicode.Inherited) {
+			continue
+		}
+		if !unicode.In(r, allowed...) {
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+// uppercaseRatio returns the share of uppercase letters and the number of letters
+func uppercaseRatio(text string) (float64, int) {
+	var letters, upper int
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	if letters == 0 {
+		return 0, 0
+	}
+	return float64(upper) / float64(letters), letters
+}
+
+// longestRepeat returns the longest run of the same non-space character
+func longestRepeat(text string) int {
+	longest, run := 0, 0
+	var last rune = -1
+	for _, r := range text {
+		if r == last && !unicode.IsSpace(r) {
+			run++
+		} else {
+			run = 1
+		}
+		last = r
+		longest = max(longest, run)
+	}
+	return longest
+}
+
+// scriptTables looks up Unicode scripts by name, e.g. "Latin" or "Cyrillic"
+func scriptTables(names []string) ([]*unicode.RangeTable, error) {
+	tables := make([]*unicode.RangeTable, 0, len(names))
+	for _, name := range names {
+		table, exists := unicode.Scripts[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown Unicode script %q", name)
+		}
+		tables = append(tables, table)
+	}
+	return tables, nil
+}
+
+func (c *Check) heuristics(sub FormSubmission) (bool, error) {
+	cfg := sub.FormCfg.Heuristics
+	// the raw values still contain the markup that sanitizing strips
+	body := sub.Raw
+	if body == nil {
+		body = sub.Body
+	}
+	var allowed []*unicode.RangeTable
+	if len(cfg.Scripts) > 0 {
+		// the names are checked by NewFormHandler
+		allowed, _ = scriptTables(cfg.Scripts)
+	}
+
+	var problems []string
+	links := 0
+	for _, field := range (BlockRule{}).fieldsFor(sub) {
+		text := body[field]
+		if text == "" {
+			continue
+		}
+		links += countLinks(text)
+		if cfg.BlockMarkup && hasMarkupLinks(text) {
+			problems = append(problems, fmt.Sprintf("%s contains markup links", field))
+		}
+		if len(allowed) > 0 {
+			if r, found := disallowedScript(text, allowed); found {
+				problems = append(problems, fmt.Sprintf("%s contains disallowed script character %q", field, r))
+			}
+		}
+		if cfg.MaxUppercase > 0 {
+			if ratio, letters := uppercaseRatio(text); letters >= minUppercaseLetters && ratio > cfg.MaxUppercase {
+				problems = append(problems, fmt.Sprintf("%s is %.0f%% uppercase", field, ratio*100))
+			}
+		}
+		if cfg.MaxRepeat > 0 {
+			if repeat := longestRepeat(text); repeat > cfg.MaxRepeat {
+				problems = append(problems, fmt.Sprintf("%s repeats a character %d times", field, repeat))
+			}
+		}
+	}
+	if cfg.MaxLinks != nil && links > *cfg.MaxLinks {
+		problems = append(problems, fmt.Sprintf("%d links, at most %d allowed", links, *cfg.MaxLinks))
+	}
+
+	if len(problems) > 0 {
+		return false, errors.New(strings.Join(problems, "; "))
+	}
+	return true, nil
+}
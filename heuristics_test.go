@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheck_heuristics(t *testing.T) {
+	c := &Check{}
+	maxLinks := 2
+	formCfg := FormConfig{Heuristics: HeuristicsConfig{
+		MaxLinks:     &maxLinks,
+		BlockMarkup:  true,
+		Scripts:      []string{"Latin"},
+		MaxUppercase: 0.7,
+		MaxRepeat:    5,
+	}}
+	formCfg.Fields.Name = "name"
+	formCfg.Fields.Message = "message"
+
+	tests := []struct {
+		name     string
+		body     map[string]string
+		raw      map[string]string
+		expected bool
+		problem  string
+	}{
+		{"Ham", map[string]string{"name": "Zoë", "message": "See https://example.com, thanks! 😀"}, nil, true, ""},
+		{"Too many links", map[string]string{"message": "http://a.example www.b.example https://c.example"}, nil, false, "3 links"},
+		{"Links across fields", map[string]string{"name": "www.a.example", "message": "http://b.example http://c.example"}, nil, false, "3 links"},
+		{"BBCode link", map[string]string{"message": "[url=http://spam.example]cheap[/url]"}, nil, false, "markup links"},
+		{"HTML link in raw value", map[string]string{"message": "cheap"}, map[string]string{"message": `<a href="http://spam.example">cheap</a>`}, false, "markup links"},
+		{"Disallowed script", map[string]string{"message": "Привет, купите"}, nil, false, "disallowed script"},
+		{"Uppercase", map[string]string{"message": "BUY NOW THE BEST DEAL ON THE INTERNET"}, nil, false, "uppercase"},
+		{"Short uppercase is fine", map[string]string{"message": "OK THANKS"}, nil, true, ""},
+		{"Repeated characters", map[string]string{"message": "hello!!!!!!!!"}, nil, false, "repeats a character 8 times"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sub := FormSubmission{FormCfg: formCfg, Body: test.body, Raw: test.raw}
+			pass, err := c.heuristics(sub)
+			if pass != test.expected {
+				t.Errorf("Expected %v, got %v (%v)", test.expected, pass, err)
+			}
+			if test.problem != "" && (err == nil || !strings.Contains(err.Error(), test.problem)) {
+				t.Errorf("Expected error containing %q, got %v", test.problem, err)
+			}
+		})
+	}
+
+	// no limits configured
+	sub := FormSubmission{Body: map[string]string{"message": "HELLO!!!!!!!!!! http://a http://b http://c"}}
+	sub.FormCfg.Fields.Message = "message"
+	if pass, err := c.heuristics(sub); !pass {
+		t.Errorf("Expected pass without limits, got %v", err)
+	}
+
+	// no links allowed
+	noLinks := 0
+	sub.FormCfg.Heuristics.MaxLinks = &noLinks
+	sub.Body = map[string]string{"message": "see http://a.example"}
+	if pass, err := c.heuristics(sub); pass || err == nil || !strings.Contains(err.Error(), "at most 0 allowed") {
+		t.Errorf("Expected a link to fail with maxLinks 0, got %v", err)
+	}
+}
+
+func TestLongestRepeat(t *testing.T) {
+	tests := map[string]int{
+		"":           0,
+		"abc":        1,
+		"aaabbbb":    4,
+		"a     b":    1,
+		"loooool!!!": 5,
+		"ååå":        3,
+	}
+	for text, expected := range tests {
+		if result := longestRepeat(text); result != expected {
+			t.Errorf("longestRepeat(%q): Expected %v, got %v", text, expected, result)
+		}
+	}
+}
+
+func TestNewFormHandler_unknownScript(t *testing.T) {
+	formCfg := FormConfig{Heuristics: HeuristicsConfig{Scripts: []string{"Latin", "Klingon"}}}
+	if _, err := NewFormHandler(&Config{Forms: map[string]FormConfig{"contact": formCfg}}); err == nil || !strings.Contains(err.Error(), "Klingon") {
+		t.Errorf("Expected an error for the unknown script, got %v", err)
+	}
+}
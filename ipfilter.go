@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+type ipVerdict int
+
+const (
+	ipUnlisted ipVerdict = iota
+	ipAllowed
+	ipBlocked
+)
+
+// ipList is a set of static prefixes plus an optional reloadable file
+type ipList struct {
+	static []netip.Prefix
+	file   *listFile[[]netip.Prefix]
+}
+
+func newIPList(entries []string, path string) (ipList, error) {
+	static, err := parsePrefixes(entries)
+	if err != nil {
+		return ipList{}, err
+	}
+	list := ipList{static: static}
+	if path != "" {
+		list.file = newListFile(path, parsePrefixes)
+	}
+	return list, nil
+}
+
+func (l ipList) contains(addr netip.Addr) bool {
+	if containsAddr(l.static, addr) {
+		return true
+	}
+	return l.file != nil && containsAddr(l.file.Get(), addr)
+}
+
+type ipFilterLists struct {
+	allow ipList
+	block ipList
+}
+
+func newIPFilterLists(conf IPFilterConfig) (ipFilterLists, error) {
+	allow, err := newIPList(conf.Allow, conf.AllowFile)
+	if err != nil {
+		return ipFilterLists{}, fmt.Errorf("allow: %w", err)
+	}
+	block, err := newIPList(conf.Block, conf.BlockFile)
+	if err != nil {
+		return ipFilterLists{}, fmt.Errorf("block: %w", err)
+	}
+	return ipFilterLists{allow: allow, block: block}, nil
+}
+
+// IPFilter matches client IPs against the global and per-form allowlists and blocklists
+type IPFilter struct {
+	global ipFilterLists
+	forms  map[string]ipFilterLists
+}
+
+func NewIPFilter(conf *Config) (*IPFilter, error) {
+	global, err := newIPFilterLists(conf.Global.IPFilter)
+	if err != nil {
+		return nil, err
+	}
+	f := &IPFilter{
+		global: global,
+		forms:  make(map[string]ipFilterLists),
+	}
+	for id, form := range conf.Forms {
+		if f.forms[id], err = newIPFilterLists(form.IPFilter); err != nil {
+			return nil, fmt.Errorf("form %s: %w", id, err)
+		}
+	}
+	return f, nil
+}
+
+// Match checks an IP against the lists for a form. Allowlists take precedence
+// over blocklists so that single hosts can be exempted from a blocked range.
+func (f *IPFilter) Match(id string, ip string) ipVerdict {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ipUnlisted
+	}
+	form := f.forms[id]
+	if form.allow.contains(addr) || f.global.allow.contains(addr) {
+		return ipAllowed
+	}
+	if form.block.contains(addr) || f.global.block.contains(addr) {
+		return ipBlocked
+	}
+	return ipUnlisted
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIPFilter_Match(t *testing.T) {
+	conf := &Config{
+		Forms: map[string]FormConfig{
+			"contact": {IPFilter: IPFilterConfig{
+				Allow: []string{"203.0.113.7"},
+				Block: []string{"2001:db8::/32"},
+			}},
+		},
+	}
+	conf.Global.IPFilter.Block = []string{"203.0.113.0/24"}
+	f, err := NewIPFilter(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id       string
+		ip       string
+		expected ipVerdict
+	}{
+		{"contact", "198.51.100.1", ipUnlisted},
+		{"contact", "203.0.113.1", ipBlocked},
+		{"contact", "203.0.113.7", ipAllowed},
+		{"other", "203.0.113.7", ipBlocked},
+		{"contact", "2001:db8::1", ipBlocked},
+		{"other", "2001:db8::1", ipUnlisted},
+		{"contact", "::ffff:203.0.113.1", ipBlocked},
+		{"contact", "not an ip", ipUnlisted},
+	}
+	for _, test := range tests {
+		if verdict := f.Match(test.id, test.ip); verdict != test.expected {
+			t.Errorf("%s %s: Expected %v, got %v", test.id, test.ip, test.expected, verdict)
+		}
+	}
+}
+
+func TestIPFilter_reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("# bad hosts\n198.51.100.0/24\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	conf := &Config{}
+	conf.Global.IPFilter.BlockFile = path
+	f, err := NewIPFilter(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if verdict := f.Match("contact", "198.51.100.9"); verdict != ipBlocked {
+		t.Errorf("Expected %v, got %v", ipBlocked, verdict)
+	}
+
+	if err := os.WriteFile(path, []byte("2001:db8::/32\n10.0.0.1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// skip the reload interval
+	f.global.block.file.checked = time.Time{}
+
+	if verdict := f.Match("contact", "198.51.100.9"); verdict != ipUnlisted {
+		t.Errorf("Expected %v after reload, got %v", ipUnlisted, verdict)
+	}
+	if verdict := f.Match("contact", "2001:db8::5"); verdict != ipBlocked {
+		t.Errorf("Expected %v after reload, got %v", ipBlocked, verdict)
+	}
+}
+
+func TestNewIPFilter_invalidEntry(t *testing.T) {
+	conf := &Config{Forms: map[string]FormConfig{
+		"contact": {IPFilter: IPFilterConfig{Allow: []string{"198.51.100.0/33"}}},
+	}}
+	if _, err := NewIPFilter(conf); err == nil {
+		t.Error("Expected an error for an invalid allowlist entry, got nil")
+	}
+}
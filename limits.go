@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+)
+
+// defaults for submissions without configured limits
+const (
+	defaultMaxBodySize    = 1 << 20
+	defaultMaxFields      = 100
+	defaultMaxValueLength = 64 << 10
+)
+
+// limitsFor returns the form's limits, falling back to the global limits
+// and then the defaults for each one that is not set
+func (conf *Config) limitsFor(formCfg FormConfig) LimitsConfig {
+	limits := formCfg.Limits
+	global := conf.Global.Limits
+	if limits.MaxBodySize <= 0 {
+		limits.MaxBodySize = global.MaxBodySize
+	}
+	if limits.MaxFields <= 0 {
+		limits.MaxFields = global.MaxFields
+	}
+	if limits.MaxValueLength <= 0 {
+		limits.MaxValueLength = global.MaxValueLength
+	}
+	if limits.MaxBodySize <= 0 {
+		limits.MaxBodySize = defaultMaxBodySize
+	}
+	if limits.MaxFields <= 0 {
+		limits.MaxFields = defaultMaxFields
+	}
+	if limits.MaxValueLength <= 0 {
+		limits.MaxValueLength = defaultMaxValueLength
+	}
+	return limits
+}
+
+// parseForm parses the request body within the limits. Oversized requests
+// fail with errTooLarge, malformed ones with errBadRequest.
+func parseForm(r *http.Request, limits LimitsConfig) error {
+	if r.ContentLength > limits.MaxBodySize {
+		return submissionError(errTooLarge, fmt.Errorf("body of %d bytes", r.ContentLength))
+	}
+	if err := r.ParseForm(); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return submissionError(errTooLarge, err)
+		}
+		return submissionError(errBadRequest, err)
+	}
+	values := 0
+	for field, v := range r.Form {
+		values += len(v)
+		for _, value := range v {
+			if n := utf8.RuneCountInString(value); n > limits.MaxValueLength {
+				return submissionError(errTooLarge, fmt.Errorf("%s is %d characters long", field, n))
+			}
+		}
+	}
+	if values > limits.MaxFields {
+		return submissionError(errTooLarge, fmt.Errorf("%d fields", values))
+	}
+	return nil
+}
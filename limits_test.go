@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConfig_limitsFor(t *testing.T) {
+	conf := &Config{}
+	conf.Global.Limits.MaxFields = 20
+	formCfg := FormConfig{Limits: LimitsConfig{MaxBodySize: 1000}}
+
+	limits := conf.limitsFor(formCfg)
+	expected := LimitsConfig{MaxBodySize: 1000, MaxFields: 20, MaxValueLength: defaultMaxValueLength}
+	if limits != expected {
+		t.Errorf("Expected %v, got %v", expected, limits)
+	}
+}
+
+func TestParseForm(t *testing.T) {
+	limits := LimitsConfig{MaxBodySize: 64, MaxFields: 3, MaxValueLength: 5}
+	tests := []struct {
+		name     string
+		body     string
+		expected error
+	}{
+		{"Within limits", "a=1&b=héllo", nil},
+		{"Malformed", "a=%zz", errBadRequest},
+		{"Too many fields", "a=1&b=2&a=3&d=4", errTooLarge},
+		{"Value too long", "a=toolong", errTooLarge},
+		{"Body too large", "a=" + strings.Repeat("x", 100), errTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/contact", strings.NewReader(test.body))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			err := parseForm(r, limits)
+			if test.expected == nil && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+			if test.expected != nil && !errors.Is(err, test.expected) {
+				t.Errorf("Expected %v, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestFormHandler_handleFormSubmissionTooLarge(t *testing.T) {
+	fh, mux := newFormTestHandler(t)
+	fh.Config.Global.Limits.MaxBodySize = 32
+
+	// without a Content-Length the body is cut off while parsing
+	r := httptest.NewRequest("POST", "/contact", io.MultiReader(strings.NewReader("message="), strings.NewReader(strings.Repeat("x", 100))))
+	r.ContentLength = -1
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected %v, got %v", http.StatusRequestEntityTooLarge, w.Code)
+	}
+
+	if w := postForm(mux, "/contact", "message="+strings.Repeat("x", 100)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected %v, got %v", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
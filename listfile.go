@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how often list files are checked for changes
+const listReloadInterval = 5 * time.Second
+
+// listFile is a file with one entry per line that is reloaded when it changes.
+// Blank lines and lines starting with # are ignored.
+type listFile[T any] struct {
+	path    string
+	parse   func([]string) (T, error)
+	mu      sync.Mutex
+	value   T
+	modTime time.Time
+	size    int64
+	checked time.Time
+}
+
+func newListFile[T any](path string, parse func([]string) (T, error)) *listFile[T] {
+	lf := &listFile[T]{path: path, parse: parse}
+	lf.reload(time.Now())
+	return lf
+}
+
+// Get returns the parsed contents of the file, reloading it if it has changed
+func (lf *listFile[T]) Get() T {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if now := time.Now(); now.Sub(lf.checked) >= listReloadInterval {
+		lf.reload(now)
+	}
+	return lf.value
+}
+
+// Reload checks the file for changes now, e.g. after it was edited
+func (lf *listFile[T]) Reload() {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	lf.reload(time.Now())
+}
+
+// reload reads the file if its modification time or size changed.
+// On error the previously loaded value is kept.
+func (lf *listFile[T]) reload(now time.Time) {
+	lf.checked = now
+	info, err := os.Stat(lf.path)
+	if err != nil {
+		slog.Warn("Could not stat list file:", slog.String("path", lf.path), slog.Any("error", err))
+		return
+	}
+	if info.ModTime().Equal(lf.modTime) && info.Size() == lf.size {
+		return
+	}
+	lines, err := readLines(lf.path)
+	if err != nil {
+		slog.Warn("Could not read list file:", slog.String("path", lf.path), slog.Any("error", err))
+		return
+	}
+	value, err := lf.parse(lines)
+	if err != nil {
+		slog.Warn("Could not parse list file:", slog.String("path", lf.path), slog.Any("error", err))
+		return
+	}
+	lf.value = value
+	lf.modTime = info.ModTime()
+	lf.size = info.Size()
+	slog.Info("Loaded list file:", slog.String("path", lf.path), slog.Int("entries", len(lines)))
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// appendLine adds a line to a list file, creating it if needed
+func appendLine(path string, line string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// removeLine removes every line equal to line from a list file and reports
+// whether any was found. Comments and blank lines are kept.
+func removeLine(path string, line string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	kept := lines[:0]
+	for _, l := range lines {
+		if strings.TrimSpace(l) == line {
+			continue
+		}
+		kept = append(kept, l)
+	}
+	if len(kept) == len(lines) {
+		return false, nil
+	}
+	return true, writeFileAtomic(path, []byte(strings.Join(kept, "")), 0o644)
+}
+
+// writeFileAtomic replaces a file through a uniquely named temporary file,
+// so readers and other writers never see it half written
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
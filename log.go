@@ -1,45 +1,277 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/lkhrs/fohago/middleware"
 )
 
-type ServiceLogger struct {
-	stdout *os.File
-	file   *os.File
+// Logs holds the service and access loggers and the files they write to
+type Logs struct {
+	Service *slog.Logger
+	Access  *slog.Logger
+	files   []*logFile
+	closers []io.Closer
 }
 
-func (s *ServiceLogger) Write(event []byte) (n int, err error) {
-	n, err = s.stdout.Write(event)
+// default outputs, kept from before they were configurable
+var (
+	defaultServiceOutputs = []string{"stdout", "fohago.log"}
+	defaultAccessOutputs  = []string{"access_log.json"}
+)
+
+// openLogs sets up the service and access logs from the config
+func openLogs(conf *Config) (*Logs, error) {
+	logs := &Logs{}
+	serviceCfg := conf.Global.Log
+	if serviceCfg.Level == "" {
+		serviceCfg.Level = conf.Global.LogLevel
+	}
+	if strings.EqualFold(serviceCfg.Format, "combined") {
+		return nil, errors.New("service log: the combined format is only for the access log")
+	}
+	service, err := logs.handler(serviceCfg, defaultServiceOutputs, "text", conf.signingKey)
+	if err != nil {
+		logs.Close()
+		return nil, fmt.Errorf("service log: %w", err)
+	}
+	access, err := logs.handler(conf.Global.AccessLog, defaultAccessOutputs, "json", conf.signingKey)
 	if err != nil {
-		return n, err
+		logs.Close()
+		return nil, fmt.Errorf("access log: %w", err)
 	}
-	n, err = s.file.Write(event)
-	return n, err
+	logs.Service = slog.New(service)
+	logs.Access = slog.New(access)
+	return logs, nil
 }
 
-func ServiceLogHandler() (logHandler slog.Handler) {
-	serviceLog, err := os.OpenFile("fohago.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
-	if err != nil {
-		panic(err)
+// handler returns a handler that writes to all outputs of a log. key is
+// called for the key that hashes personal data if PII is "hash".
+func (logs *Logs) handler(cfg LogConfig, defaultOutputs []string, defaultFormat string, key func() []byte) (slog.Handler, error) {
+	var level slog.Level
+	if cfg.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return nil, err
+		}
+	}
+	format := cmp.Or(strings.ToLower(cfg.Format), defaultFormat)
+	if format != "text" && format != "json" && format != "combined" {
+		return nil, fmt.Errorf("unknown format %q", cfg.Format)
+	}
+	pii := strings.ToLower(cfg.PII)
+	if pii != "" && pii != "keep" && pii != "redact" && pii != "hash" {
+		return nil, fmt.Errorf("unknown PII mode %q", cfg.PII)
+	}
+	outputs := cfg.Outputs
+	if len(outputs) == 0 {
+		outputs = defaultOutputs
+	}
+
+	var handlers multiHandler
+	var writers []io.Writer
+	for _, output := range outputs {
+		switch {
+		case output == "stdout":
+			writers = append(writers, os.Stdout)
+		case output == "stderr":
+			writers = append(writers, os.Stderr)
+		case output == "syslog" || strings.HasPrefix(output, "syslog://") || strings.HasPrefix(output, "syslog+tcp://"):
+			h, closer, err := newSyslogHandler(output, format, level)
+			if err != nil {
+				return nil, err
+			}
+			logs.closers = append(logs.closers, closer)
+			handlers = append(handlers, h)
+		default:
+			f, err := openLogFile(output, cfg)
+			if err != nil {
+				return nil, err
+			}
+			logs.files = append(logs.files, f)
+			writers = append(writers, f)
+		}
+	}
+	if len(writers) > 0 {
+		handlers = append(handlers, newFormatHandler(io.MultiWriter(writers...), format, level, nil))
+	}
+	var h slog.Handler = handlers
+	if len(handlers) == 1 {
+		h = handlers[0]
 	}
-	defer serviceLog.Close()
-	logWriter := &ServiceLogger{
-		stdout: os.Stdout,
-		file:   serviceLog,
+	switch pii {
+	case "redact":
+		h = piiHandler{Handler: h}
+	case "hash":
+		h = piiHandler{Handler: h, key: piiKey(key())}
 	}
-	logHandler = slog.NewTextHandler(logWriter, nil)
-	return
+	return h, nil
 }
-func AccessLogHandler() (logHandler slog.Handler) {
-	accessLog, err := os.OpenFile("access_log.json", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-	if err != nil {
-		panic(err)
+
+// newFormatHandler returns a text, JSON or Combined Log Format handler
+func newFormatHandler(w io.Writer, format string, level slog.Level, replace func([]string, slog.Attr) slog.Attr) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: replace}
+	switch format {
+	case "json":
+		return slog.NewJSONHandler(w, opts)
+	case "combined":
+		return middleware.NewCombinedHandler(w)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// Reopen closes and opens the log files again, for logrotate
+func (logs *Logs) Reopen() error {
+	var errs []error
+	for _, f := range logs.files {
+		errs = append(errs, f.Reopen())
+	}
+	return errors.Join(errs...)
+}
+
+func (logs *Logs) Close() error {
+	var errs []error
+	for _, f := range logs.files {
+		errs = append(errs, f.Close())
+	}
+	for _, c := range logs.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// multiHandler sends records to several handlers
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, h := range m {
+		if h.Enabled(ctx, record.Level) {
+			errs = append(errs, h.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithAttrs(attrs)
 	}
-	defer accessLog.Close()
-	logHandler = slog.NewJSONHandler(accessLog, &slog.HandlerOptions{
-		Level: slog.LevelDebug,
+	return handlers
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
+
+// attributes holding personal data
+var piiKeys = []string{"ip", "email", "remote_addr", "client_ip"}
+
+// email addresses in free text like check reasons and SMTP errors
+var emailPattern = regexp.MustCompile(`[^\s<>"'(),;:@]+@[^\s<>"'(),;:@]+`)
+
+// request headers holding client IPs
+var piiHeaders = []string{"X-Forwarded-For", "X-Real-Ip", "Forwarded", "Cf-Connecting-Ip", "True-Client-Ip"}
+
+// piiKey derives the key that hashes personal data in logs
+func piiKey(signingKey []byte) []byte {
+	key := sha256.Sum256(append([]byte("pii\x00"), signingKey...))
+	return key[:]
+}
+
+// piiHandler redacts IP and email addresses, or replaces them with a keyed
+// hash if key is set so entries of the same client can still be matched.
+// Email addresses are also masked in other text, such as errors.
+type piiHandler struct {
+	slog.Handler
+	key []byte
+}
+
+func (h piiHandler) Handle(ctx context.Context, record slog.Record) error {
+	clean := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		clean.AddAttrs(h.replace(attr))
+		return true
 	})
-	return
+	return h.Handler.Handle(ctx, clean)
+}
+
+func (h piiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clean := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		clean[i] = h.replace(attr)
+	}
+	return piiHandler{Handler: h.Handler.WithAttrs(clean), key: h.key}
+}
+
+func (h piiHandler) WithGroup(name string) slog.Handler {
+	return piiHandler{Handler: h.Handler.WithGroup(name), key: h.key}
+}
+
+func (h piiHandler) replace(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch {
+	case value.Kind() == slog.KindGroup:
+		group := value.Group()
+		clean := make([]any, len(group))
+		for i, a := range group {
+			clean[i] = h.replace(a)
+		}
+		return slog.Group(attr.Key, clean...)
+	case slices.Contains(piiKeys, attr.Key):
+		return slog.String(attr.Key, h.mask(value.String()))
+	case value.Kind() == slog.KindString:
+		return slog.String(attr.Key, emailPattern.ReplaceAllStringFunc(value.String(), h.mask))
+	}
+	if err, ok := value.Any().(error); ok && value.Kind() == slog.KindAny {
+		return slog.String(attr.Key, emailPattern.ReplaceAllStringFunc(err.Error(), h.mask))
+	}
+	if header, ok := value.Any().(http.Header); ok && value.Kind() == slog.KindAny {
+		header = header.Clone()
+		for _, name := range piiHeaders {
+			for i, v := range header[name] {
+				header[name][i] = h.mask(v)
+			}
+		}
+		return slog.Any(attr.Key, header)
+	}
+	return attr
+}
+
+func (h piiHandler) mask(s string) string {
+	if s == "" {
+		return ""
+	}
+	if h.key == nil {
+		return "[REDACTED]"
+	}
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
 }
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenLogs(t *testing.T) {
+	dir := t.TempDir()
+	conf := &Config{}
+	conf.Global.LogLevel = "warn"
+	conf.Global.Log.Outputs = []string{filepath.Join(dir, "service.log")}
+	conf.Global.AccessLog.Outputs = []string{filepath.Join(dir, "access.log")}
+	conf.Global.AccessLog.Format = "json"
+	logs, err := openLogs(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs.Service.Info("hidden")
+	logs.Service.Warn("shown")
+	logs.Access.Info("request", "status", 200)
+	logs.Close()
+
+	service, _ := os.ReadFile(filepath.Join(dir, "service.log"))
+	if strings.Contains(string(service), "hidden") || !strings.Contains(string(service), "msg=shown") {
+		t.Errorf("Expected only the warning as text, got %v", string(service))
+	}
+	access, _ := os.ReadFile(filepath.Join(dir, "access.log"))
+	var entry map[string]any
+	if err := json.Unmarshal(access, &entry); err != nil || entry["status"] != float64(200) {
+		t.Errorf("Expected a JSON entry, got %v", string(access))
+	}
+
+	for _, test := range []func(*Config){
+		func(c *Config) { c.Global.Log.Format = "combined" },
+		func(c *Config) { c.Global.AccessLog.Format = "xml" },
+		func(c *Config) { c.Global.AccessLog.Level = "loud" },
+		func(c *Config) { c.Global.AccessLog.PII = "scramble" },
+		func(c *Config) { c.Global.AccessLog.Outputs = []string{filepath.Join(dir, "missing", "access.log")} },
+	} {
+		bad := *conf
+		test(&bad)
+		if _, err := openLogs(&bad); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+	}
+}
+
+func TestLogFile_rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fohago.log")
+	f, err := openLogFile(path, LogConfig{MaxSize: 1, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	line := []byte(strings.Repeat("x", 700<<10) + "\n")
+	for range 4 {
+		if _, err := f.Write(line); err != nil {
+			t.Fatal(err)
+		}
+		// rotated files are named by the millisecond
+		time.Sleep(2 * time.Millisecond)
+	}
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Errorf("Expected %v, got %v", 2, backups)
+	}
+	info, _ := os.Stat(path)
+	if info.Size() != int64(len(line)) {
+		t.Errorf("Expected %v, got %v", len(line), info.Size())
+	}
+
+	f.interval = time.Hour
+	f.maxSize = 0
+	if f.due(1, time.Now()) {
+		t.Error("Expected no rotation before the interval")
+	}
+	if !f.due(1, time.Now().Add(time.Hour)) {
+		t.Error("Expected a rotation after the interval")
+	}
+}
+
+func TestLogFile_rotateRenameFails(t *testing.T) {
+	// too long for the rotated name with its timestamp
+	path := filepath.Join(t.TempDir(), strings.Repeat("a", 240)+".log")
+	f, err := openLogFile(path, LogConfig{MaxSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	line := []byte(strings.Repeat("x", 700<<10) + "\n")
+	f.Write(line)
+	if _, err := f.Write(line); err != nil {
+		t.Fatalf("Expected the write to succeed, got %v", err)
+	}
+	if !f.rotateFailed || f.size != int64(len(line)) {
+		t.Errorf("Expected the size to be reset after a failed rotation, got %v", f.size)
+	}
+	opened := f.opened
+	if _, err := f.Write([]byte("after\n")); err != nil || f.opened != opened {
+		t.Errorf("Expected the file to be kept open without another rotation, got %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 2*int64(len(line))+6 {
+		t.Errorf("Expected all lines in the original file, got %v", err)
+	}
+}
+
+func TestLogFile_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := openLogFile(path, LogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write([]byte("before\n"))
+	// what logrotate does before sending SIGHUP
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("after\n"))
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "after\n" {
+		t.Errorf("Expected %q, got %q", "after\n", string(data))
+	}
+}
+
+func TestPIIHandler(t *testing.T) {
+	var buf bytes.Buffer
+	inner := slog.NewJSONHandler(&buf, nil)
+	header := http.Header{"X-Forwarded-For": {"192.0.2.1"}, "Accept": {"*/*"}}
+
+	tests := []struct {
+		name    string
+		handler slog.Handler
+		masked  string
+	}{
+		{"Redact", piiHandler{Handler: inner}, "[REDACTED]"},
+		{"Hash", piiHandler{Handler: inner, key: piiKey([]byte("secret"))}, piiHandler{key: piiKey([]byte("secret"))}.mask("192.0.2.1")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf.Reset()
+			logger := slog.New(test.handler).With(slog.String("ip", "192.0.2.1"))
+			logger.Info("test", slog.String("form", "contact"), slog.Group("client", slog.String("email", "a@example.com")), slog.Any("headers", header))
+			if strings.Contains(buf.String(), "192.0.2.1") || strings.Contains(buf.String(), "a@example.com") {
+				t.Errorf("Expected personal data to be masked, got %v", buf.String())
+			}
+			var entry struct {
+				IP      string              `json:"ip"`
+				Form    string              `json:"form"`
+				Headers map[string][]string `json:"headers"`
+			}
+			json.Unmarshal(buf.Bytes(), &entry)
+			if entry.IP != test.masked {
+				t.Errorf("Expected %v, got %v", test.masked, entry.IP)
+			}
+			if entry.Form != "contact" || entry.Headers["Accept"][0] != "*/*" {
+				t.Errorf("Expected other attributes to be kept, got %v", buf.String())
+			}
+		})
+	}
+	if header.Get("X-Forwarded-For") != "192.0.2.1" {
+		t.Error("Expected the logged headers not to be modified")
+	}
+}
+
+func TestPIIRedactFailedEmailCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "service.log")
+	conf := &Config{}
+	conf.Global.Log.Outputs = []string{path}
+	conf.Global.Log.PII = "redact"
+	conf.Global.AccessLog.Outputs = []string{filepath.Join(filepath.Dir(path), "access.log")}
+	logs, err := openLogs(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultLogger := slog.Default()
+	slog.SetDefault(logs.Service)
+	defer slog.SetDefault(defaultLogger)
+
+	fh := &FormHandler{Config: conf, EmailChecker: NewEmailChecker(conf)}
+	formCfg := FormConfig{EmailCheck: EmailCheckConfig{Enabled: true}}
+	formCfg.Fields.Email = "email"
+	sub := FormSubmission{Id: "contact", FormCfg: formCfg, UserIP: "192.0.2.1", Body: FormBody{"email": "Ann <ann@example.com>"}}
+	if result := fh.checkSpam(sub); result.Verdict != spamReject {
+		t.Fatalf("Expected the email check to fail, got %v", result.Verdict)
+	}
+	sub.logger().Error("Failed to send email:", slog.Any("smtp_error", errors.New("550 5.1.1 <ann@example.com>: Recipient address rejected")))
+	logs.Close()
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "check=email") {
+		t.Fatalf("Expected the failed check to be logged, got %v", string(data))
+	}
+	if strings.Contains(string(data), "ann@example.com") || strings.Contains(string(data), "192.0.2.1") {
+		t.Errorf("Expected personal data to be redacted, got %v", string(data))
+	}
+}
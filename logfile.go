@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// logFile is a log file that rotates when it grows past MaxSize or is older
+// than Interval, and can be reopened after an external tool rotated it
+type logFile struct {
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+
+	mu           sync.Mutex
+	file         *os.File
+	size         int64
+	opened       time.Time
+	rotateFailed bool
+}
+
+// format of the timestamp added to rotated files
+const rotatedTimeFormat = "20060102-150405.000"
+
+func openLogFile(path string, cfg LogConfig) (*logFile, error) {
+	f := &logFile{
+		path:       path,
+		maxSize:    cfg.MaxSize << 20,
+		interval:   cfg.Interval,
+		maxBackups: cfg.MaxBackups,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *logFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+func (f *logFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.size > 0 && f.due(int64(len(p)), time.Now()) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// due reports whether writing n more bytes needs a rotation first
+func (f *logFile) due(n int64, now time.Time) bool {
+	return (f.maxSize > 0 && f.size+n > f.maxSize) ||
+		(f.interval > 0 && now.Sub(f.opened) >= f.interval)
+}
+
+// rotate renames the file with a timestamp, opens a new one and removes
+// the oldest rotated files beyond maxBackups. If the rename fails the
+// file is opened again and kept, so it only fails if no file can be opened.
+func (f *logFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+	rotated := f.path + "." + time.Now().Format(rotatedTimeFormat)
+	if err := os.Rename(f.path, rotated); err != nil {
+		// the log can't report on itself, and only the first failure is reported
+		if !f.rotateFailed {
+			fmt.Fprintf(os.Stderr, "Could not rotate log file %s: %v\n", f.path, err)
+			f.rotateFailed = true
+		}
+		if err := f.open(); err != nil {
+			return err
+		}
+		// keep writing to the current file until the next rotation is due
+		f.size = 0
+		return nil
+	}
+	f.rotateFailed = false
+	if err := f.open(); err != nil {
+		return err
+	}
+	if f.maxBackups > 0 {
+		matches, err := filepath.Glob(f.path + ".*")
+		if err != nil {
+			return err
+		}
+		var backups []string
+		for _, match := range matches {
+			if _, err := time.Parse(rotatedTimeFormat, match[len(f.path)+1:]); err == nil {
+				backups = append(backups, match)
+			}
+		}
+		// the timestamps sort oldest first
+		slices.Sort(backups)
+		for _, backup := range backups[:max(len(backups)-f.maxBackups, 0)] {
+			os.Remove(backup)
+		}
+	}
+	return nil
+}
+
+// Reopen closes the file and opens it at its path again
+func (f *logFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	return f.open()
+}
+
+func (f *logFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
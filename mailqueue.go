@@ -0,0 +1,245 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	defaultQueueSize       = 100
+	defaultQueueRetries    = 3
+	defaultQueueRetryDelay = 5 * time.Second
+	// time workers get to hand over their submissions after shutdown stops them
+	queueStopGrace = time.Second
+)
+
+var (
+	errQueueFull    = errors.New("mail queue is full")
+	errQueueClosed  = errors.New("mail queue is closed")
+	errQueueStopped = errors.New("server shut down before delivery")
+)
+
+// MailQueue delivers submissions in the background so slow SMTP servers
+// don't hold up responses. Failed deliveries are retried with backoff and
+// then quarantined so they can be delivered from the admin API, as are the
+// submissions still queued when the shutdown timeout runs out.
+type MailQueue struct {
+	send       func(FormSubmission) error
+	failed     func(FormSubmission, error)
+	jobs       chan FormSubmission
+	retries    int
+	retryDelay time.Duration
+	mu         sync.RWMutex
+	closed     bool
+	deadline   time.Time
+	stop       chan struct{}
+	stopOnce   sync.Once
+	wg         sync.WaitGroup
+
+	// submissions being delivered by a worker, by job number
+	activeMu sync.Mutex
+	active   map[int]FormSubmission
+	nextJob  int
+}
+
+// NewMailQueue returns nil if the queue is disabled, which makes delivery synchronous
+func NewMailQueue(conf *Config, send func(FormSubmission) error, failed func(FormSubmission, error)) *MailQueue {
+	cfg := conf.Global.Queue
+	if cfg.Workers <= 0 {
+		return nil
+	}
+	q := &MailQueue{
+		send:       send,
+		failed:     failed,
+		jobs:       make(chan FormSubmission, cmp.Or(cfg.Size, defaultQueueSize)),
+		retries:    cfg.Retries,
+		retryDelay: cmp.Or(cfg.RetryDelay, defaultQueueRetryDelay),
+		stop:       make(chan struct{}),
+		active:     make(map[int]FormSubmission),
+	}
+	if q.retries == 0 {
+		q.retries = defaultQueueRetries
+	}
+	q.retries = max(q.retries, 0)
+	for range cfg.Workers {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+func (q *MailQueue) work() {
+	defer q.wg.Done()
+	for sub := range q.jobs {
+		job := q.begin(sub)
+		select {
+		case <-q.stop:
+			q.fail(job, sub, errQueueStopped)
+		default:
+			q.deliver(job, sub)
+		}
+	}
+}
+
+// begin marks a submission as being delivered and returns its job number
+func (q *MailQueue) begin(sub FormSubmission) int {
+	q.activeMu.Lock()
+	defer q.activeMu.Unlock()
+	q.nextJob++
+	q.active[q.nextJob] = sub
+	return q.nextJob
+}
+
+// finish reports whether the job was still active, false if Close already
+// quarantined it
+func (q *MailQueue) finish(job int) bool {
+	q.activeMu.Lock()
+	defer q.activeMu.Unlock()
+	_, active := q.active[job]
+	delete(q.active, job)
+	return active
+}
+
+func (q *MailQueue) fail(job int, sub FormSubmission, err error) {
+	if q.finish(job) && q.failed != nil {
+		q.failed(sub, err)
+	}
+}
+
+// deliver sends a submission, retrying with exponential backoff. A panic
+// while sending fails the submission instead of the whole process.
+func (q *MailQueue) deliver(job int, sub FormSubmission) {
+	defer func() {
+		if r := recover(); r != nil {
+			sub.logger().Error("Mail delivery panic:", slog.Any("error", r))
+			slog.Debug("Mail delivery panic:", slog.Any("debug", debug.Stack()))
+			q.fail(job, sub, fmt.Errorf("mail delivery panic: %v", r))
+		}
+	}()
+	var err error
+	for attempt := 0; attempt <= q.retries; attempt++ {
+		if attempt > 0 && !q.wait(q.retryDelay<<(attempt-1)) {
+			break
+		}
+		if err = q.send(sub); err == nil {
+			if !q.finish(job) {
+				sub.logger().Warn("Submission delivered after it was quarantined at shutdown")
+			}
+			return
+		}
+		sub.logger().Warn("Mail delivery failed:", slog.Int("attempt", attempt+1), slog.Any("error", err))
+	}
+	q.fail(job, sub, err)
+}
+
+// wait sleeps before a retry and reports whether to go on. During shutdown
+// the delay is capped at half the time left, so the retry can finish in time.
+func (q *MailQueue) wait(delay time.Duration) bool {
+	q.mu.RLock()
+	deadline := q.deadline
+	q.mu.RUnlock()
+	if !deadline.IsZero() {
+		delay = min(delay, time.Until(deadline)/2)
+	}
+	timer := time.NewTimer(max(delay, 0))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-q.stop:
+		return false
+	}
+}
+
+func (q *MailQueue) isClosed() bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.closed
+}
+
+// Enqueue adds a submission to the queue without waiting
+func (q *MailQueue) Enqueue(sub FormSubmission) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return errQueueClosed
+	}
+	select {
+	case q.jobs <- sub:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+// Len returns the number of submissions waiting for a worker
+func (q *MailQueue) Len() int {
+	return len(q.jobs)
+}
+
+// ready returns an error if the queue does not accept submissions
+func (q *MailQueue) ready() error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return errQueueClosed
+	}
+	if len(q.jobs) == cap(q.jobs) {
+		return errQueueFull
+	}
+	return nil
+}
+
+// Close stops accepting submissions and waits until the queued ones are
+// delivered. When ctx is done first, the submissions that are queued or being
+// retried are handed to the failed callback so they are not lost.
+func (q *MailQueue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		q.deadline, _ = ctx.Deadline()
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	q.stopOnce.Do(func() { close(q.stop) })
+	for sub := range q.jobs {
+		if q.failed != nil {
+			q.failed(sub, errQueueStopped)
+		}
+	}
+	// sends in progress can't be interrupted, their submissions are
+	// quarantined too in case the process exits before they finish
+	q.activeMu.Lock()
+	active := q.active
+	q.active = make(map[int]FormSubmission)
+	q.activeMu.Unlock()
+	for _, sub := range active {
+		if q.failed != nil {
+			q.failed(sub, errQueueStopped)
+		}
+	}
+	// let stopped workers finish quarantining what they held
+	select {
+	case <-done:
+	case <-time.After(queueStopGrace):
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMailQueue(t *testing.T) {
+	conf := &Config{}
+	conf.Global.Queue.Workers = 2
+	conf.Global.Queue.Retries = 2
+	conf.Global.Queue.RetryDelay = time.Millisecond
+
+	var mu sync.Mutex
+	attempts := make(map[string]int)
+	var failed []string
+	send := func(sub FormSubmission) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[sub.Id]++
+		switch {
+		case sub.Id == "flaky" && attempts[sub.Id] < 2:
+			return errors.New("temporary failure")
+		case sub.Id == "broken":
+			return errors.New("permanent failure")
+		}
+		return nil
+	}
+	q := NewMailQueue(conf, send, func(sub FormSubmission, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, sub.Id)
+	})
+
+	for _, id := range []string{"ok", "flaky", "broken"} {
+		if err := q.Enqueue(FormSubmission{Id: id}); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+	}
+	if err := q.Close(context.Background()); err != nil {
+		t.Fatalf("Expected the queue to drain, got %v", err)
+	}
+
+	expected := map[string]int{"ok": 1, "flaky": 2, "broken": 3}
+	for id, n := range expected {
+		if attempts[id] != n {
+			t.Errorf("%s: Expected %v attempts, got %v", id, n, attempts[id])
+		}
+	}
+	if len(failed) != 1 || failed[0] != "broken" {
+		t.Errorf("Expected only broken to fail, got %v", failed)
+	}
+	if err := q.Enqueue(FormSubmission{Id: "late"}); err != errQueueClosed {
+		t.Errorf("Expected %v, got %v", errQueueClosed, err)
+	}
+}
+
+func TestMailQueue_full(t *testing.T) {
+	conf := &Config{}
+	conf.Global.Queue.Workers = 1
+	conf.Global.Queue.Size = 1
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	var mu sync.Mutex
+	var failed []string
+	q := NewMailQueue(conf, func(FormSubmission) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}, func(sub FormSubmission, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, sub.Id)
+	})
+
+	q.Enqueue(FormSubmission{Id: "first"})
+	<-started
+	if err := q.Enqueue(FormSubmission{Id: "second"}); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if err := q.Enqueue(FormSubmission{Id: "third"}); err != errQueueFull {
+		t.Errorf("Expected %v, got %v", errQueueFull, err)
+	}
+	if q.Len() != 1 {
+		t.Errorf("Expected 1 queued, got %v", q.Len())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v while blocked, got %v", context.DeadlineExceeded, err)
+	}
+	// the queued and the blocked submission are handed over instead of lost
+	mu.Lock()
+	slices.Sort(failed)
+	if !slices.Equal(failed, []string{"first", "second"}) {
+		t.Errorf("Expected %v, got %v", []string{"first", "second"}, failed)
+	}
+	mu.Unlock()
+	close(release)
+	if err := q.Close(context.Background()); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if NewMailQueue(&Config{}, nil, nil) != nil {
+		t.Error("Expected no queue without workers")
+	}
+}
+
+func TestMailQueue_closeDuringRetries(t *testing.T) {
+	conf := &Config{}
+	conf.Global.Queue.Workers = 1
+	conf.Global.Queue.Retries = 3
+	conf.Global.Queue.RetryDelay = time.Hour
+
+	var q *MailQueue
+	var mu sync.Mutex
+	attempts := 0
+	var failed []string
+	q = NewMailQueue(conf, func(sub FormSubmission) error {
+		mu.Lock()
+		attempts++
+		n := attempts
+		mu.Unlock()
+		if sub.Id != "flaky" {
+			return errors.New("permanent failure")
+		}
+		if n == 1 {
+			// fail once the queue is shutting down, so the hour long
+			// backoff is capped by the shutdown deadline
+			for !q.isClosed() {
+				time.Sleep(time.Millisecond)
+			}
+			return errors.New("temporary failure")
+		}
+		return nil
+	}, func(sub FormSubmission, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, sub.Id)
+	})
+
+	q.Enqueue(FormSubmission{Id: "flaky"})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := q.Close(ctx); err != nil {
+		t.Errorf("Expected the retry to finish before the deadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Expected the backoff to be capped, took %v", elapsed)
+	}
+	if attempts != 2 || len(failed) != 0 {
+		t.Errorf("Expected delivery on the second attempt, got %v attempts and failed %v", attempts, failed)
+	}
+
+	// a job waiting out its backoff at the deadline is handed over
+	conf.Global.Queue.RetryDelay = time.Hour
+	failed = nil
+	sent := make(chan struct{})
+	var sentOnce sync.Once
+	q = NewMailQueue(conf, func(FormSubmission) error {
+		sentOnce.Do(func() { close(sent) })
+		return errors.New("permanent failure")
+	}, func(sub FormSubmission, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, sub.Id)
+	})
+	q.Enqueue(FormSubmission{Id: "broken"})
+	// closing before the worker starts its hour long backoff would cap it
+	<-sent
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failed) != 1 || failed[0] != "broken" {
+		t.Errorf("Expected broken to be handed over once, got %v", failed)
+	}
+}
+
+func TestMailQueue_panic(t *testing.T) {
+	conf := &Config{}
+	conf.Global.Queue.Workers = 1
+	var failed []string
+	q := NewMailQueue(conf, func(sub FormSubmission) error {
+		if sub.Id == "panic" {
+			panic("nil template")
+		}
+		return nil
+	}, func(sub FormSubmission, err error) {
+		failed = append(failed, sub.Id)
+	})
+	q.Enqueue(FormSubmission{Id: "panic"})
+	q.Enqueue(FormSubmission{Id: "ok"})
+	if err := q.Close(context.Background()); err != nil {
+		t.Fatalf("Expected the queue to drain, got %v", err)
+	}
+	if !slices.Equal(failed, []string{"panic"}) {
+		t.Errorf("Expected %v, got %v", []string{"panic"}, failed)
+	}
+}
@@ -3,26 +3,65 @@ package main
 import (
 	"log/slog"
 	"net/http"
-	"strconv"
+	"os"
 
 	"github.com/lkhrs/fohago/middleware"
 )
 
 func main() {
-	// Set up logging
-	serviceLogger := slog.New(ServiceLogHandler())
-	slog.SetDefault(serviceLogger)
-	accessLogger := slog.New(AccessLogHandler())
+	if len(os.Args) > 1 && os.Args[1] == "train" {
+		os.Exit(runTrain(os.Args[2:]))
+	}
 
 	// Load config
 	config := loadConfig("fohago.toml")
 
+	// Set up logging
+	logs, err := openLogs(config)
+	if err != nil {
+		slog.Error("Could not open logs:", slog.Any("error", err))
+		os.Exit(1)
+	}
+	defer logs.Close()
+	slog.SetDefault(logs.Service)
+
 	// Set up HTTP handler
 	mux := http.NewServeMux()
-	fh := NewFormHandler(config)
+	fh, err := NewFormHandler(config)
+	if err != nil {
+		slog.Error("Invalid config:", slog.Any("error", err))
+		os.Exit(1)
+	}
+	registerQueueDepth(fh.Mail)
 
 	// Routes
+	mux.HandleFunc("GET /healthz", handleHealth)
+	mux.HandleFunc("GET /readyz", fh.handleReady)
+	mux.HandleFunc("GET /version", handleVersion)
+	mux.Handle("GET /metrics", registry.Handler())
 	mux.HandleFunc("POST /{id}", fh.handleFormSubmission)
+	mux.HandleFunc("GET /{id}/challenge", fh.handleChallenge)
+	mux.HandleFunc("GET /{id}/token", fh.handleToken)
+	mux.HandleFunc("GET /{id}/state", fh.handleState)
+	mux.HandleFunc("GET /feedback/{token}/{verdict}", fh.handleFeedback)
+	mux.HandleFunc("POST /feedback/{token}/{verdict}", fh.handleFeedback)
+	mux.HandleFunc("POST /admin/train", fh.requireAdmin(fh.handleTrain))
+	mux.HandleFunc("GET /admin/quarantine/{form}", fh.requireAdmin(fh.handleListQuarantine))
+	mux.HandleFunc("GET /admin/quarantine/{form}/{sid}", fh.requireAdmin(fh.handleGetQuarantine))
+	mux.HandleFunc("POST /admin/quarantine/{form}/{sid}/{verdict}", fh.requireAdmin(fh.handleMarkQuarantine))
+	mux.HandleFunc("POST /admin/feedback/{form}/{sid}/{verdict}", fh.requireAdmin(fh.handleMarkDelivered))
+	mux.HandleFunc("GET /admin/blocklist", fh.requireAdmin(fh.handleListBlocklist))
+	mux.HandleFunc("POST /admin/blocklist", fh.requireAdmin(fh.handleEditBlocklist))
+	mux.HandleFunc("DELETE /admin/blocklist", fh.requireAdmin(fh.handleEditBlocklist))
+	mux.HandleFunc("GET /pow.js", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./pow.js")
+	})
+	mux.HandleFunc("GET /token.js", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./token.js")
+	})
+	mux.HandleFunc("GET /state.js", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./state.js")
+	})
 	mux.HandleFunc("GET /test.html", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "./test.html")
 	})
@@ -31,9 +70,20 @@ func main() {
 	})
 
 	// Middleware
-	handler := middleware.Logging(mux, accessLogger)
+	var skipLogging []string
+	if !config.Global.LogProbes {
+		skipLogging = probePaths
+	}
+	handler := middleware.Instrument(mux, observeRequest)
 	handler = middleware.PanicRecovery(handler)
+	handler = middleware.Logging(handler, logs.Access, skipLogging...)
+	handler = middleware.RequestIDs(handler)
 
 	// Start server
-	http.ListenAndServe(":"+strconv.Itoa(config.Global.Port), handler)
+	if err := run(config, handler, fh, logs); err != nil {
+		slog.Error("Server error:", slog.Any("error", err))
+		logs.Close()
+		os.Exit(1)
+	}
+	slog.Info("Server stopped")
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/lkhrs/fohago/antispam"
+	"github.com/lkhrs/fohago/metrics"
+)
+
+var (
+	registry = metrics.NewRegistry()
+
+	submissionsTotal = registry.Counter("fohago_submissions_total",
+		"Form submissions by outcome.", "form", "outcome")
+	spamChecksFailed = registry.Counter("fohago_spam_checks_failed_total",
+		"Spam checks that failed, by check name.", "form", "check")
+	smtpSendDuration = registry.Histogram("fohago_smtp_send_duration_seconds",
+		"Time taken to send an email over SMTP.", nil, "result")
+	captchaVerifyDuration = registry.Histogram("fohago_captcha_verify_duration_seconds",
+		"Time taken to verify a captcha token.", nil, "provider", "result")
+	captchaVerifyErrors = registry.Counter("fohago_captcha_verify_errors_total",
+		"Captcha verifications that could not be completed, e.g. network errors.", "provider")
+	httpRequestDuration = registry.Histogram("fohago_http_request_duration_seconds",
+		"Time taken to serve HTTP requests, by route and status code.", nil, "route", "code")
+)
+
+// submission outcomes besides the submitError kinds
+const (
+	outcomeAccepted    = "accepted"
+	outcomeQuarantined = "quarantined"
+	outcomeDuplicate   = "duplicate"
+)
+
+// formLabel returns the form id to use as a label, unknown forms share one
+// label so random paths cannot add series
+func (conf *Config) formLabel(id string) string {
+	if _, exists := conf.Forms[id]; !exists {
+		return "unknown"
+	}
+	return id
+}
+
+// observeCaptcha records the duration and result of a captcha verification.
+// Failed tokens are "fail", verifications that could not be completed are "error".
+func observeCaptcha(provider string, start time.Time, pass bool, err error) {
+	result := "pass"
+	var verifyErr *antispam.VerifyError
+	var code antispam.ErrorCode
+	switch {
+	case err == nil && pass:
+	case err == nil, errors.As(err, &verifyErr), errors.As(err, &code), provider == "pow":
+		result = "fail"
+	default:
+		result = "error"
+		captchaVerifyErrors.Inc(provider)
+	}
+	captchaVerifyDuration.Observe(time.Since(start).Seconds(), provider, result)
+}
+
+// observeRequest records the duration of an HTTP request by its mux pattern
+func observeRequest(route string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	httpRequestDuration.Observe(duration.Seconds(), route, strconv.Itoa(status))
+}
+
+// registerQueueDepth exposes the number of submissions waiting in the mail queue
+func registerQueueDepth(queue *MailQueue) {
+	registry.GaugeFunc("fohago_mail_queue_depth", "Submissions waiting in the mail queue.", func() float64 {
+		if queue == nil {
+			return 0
+		}
+		return float64(queue.Len())
+	})
+}
@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	submissions := r.Counter("test_submissions_total", "Submissions by form.", "form", "outcome")
+	latency := r.Histogram("test_latency_seconds", "Latency.", []float64{0.5, 0.1})
+	r.GaugeFunc("test_queue_depth", "Queued mail.", func() float64 { return 3 })
+
+	submissions.Inc("contact", "accepted")
+	submissions.Inc("contact", "accepted")
+	submissions.Add(1.5, `say "hi"`+"\n", "spam")
+	latency.Observe(0.05)
+	latency.Observe(0.2)
+	latency.Observe(2)
+
+	var out strings.Builder
+	if _, err := r.WriteTo(&out); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := `# HELP test_submissions_total Submissions by form.
+# TYPE test_submissions_total counter
+test_submissions_total{form="contact",outcome="accepted"} 2
+test_submissions_total{form="say \"hi\"\n",outcome="spam"} 1.5
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1"} 1
+test_latency_seconds_bucket{le="0.5"} 2
+test_latency_seconds_bucket{le="+Inf"} 3
+test_latency_seconds_sum 2.25
+test_latency_seconds_count 3
+# HELP test_queue_depth Queued mail.
+# TYPE test_queue_depth gauge
+test_queue_depth 3
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+	if v := submissions.Value("contact", "accepted"); v != 2 {
+		t.Errorf("Expected 2, got %v", v)
+	}
+	if n := latency.Count(); n != 3 {
+		t.Errorf("Expected 3, got %v", n)
+	}
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("test_total", "Test.").Inc()
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Expected the Prometheus content type, got %v", ct)
+	}
+	if !strings.Contains(w.Body.String(), "test_total 1\n") {
+		t.Errorf("Expected the counter, got %v", w.Body.String())
+	}
+}
+
+func TestCounterVec_wrongLabels(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for the wrong number of label values")
+		}
+	}()
+	NewRegistry().Counter("test_total", "Test.", "form").Inc()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lkhrs/fohago/antispam"
+	"github.com/lkhrs/fohago/middleware"
+)
+
+func TestSubmissionMetrics(t *testing.T) {
+	_, mux := newFormTestHandler(t)
+
+	tests := []struct {
+		target  string
+		body    string
+		form    string
+		outcome string
+	}{
+		{"/nope", "message=hi", "unknown", "unknown-form"},
+		{"/contact", "message=%zz", "contact", "bad-request"},
+		{"/contact", "website=spam", "contact", "spam"},
+		{"/contact", "message=hi", "contact", "delivery-failed"},
+	}
+	for _, test := range tests {
+		before := submissionsTotal.Value(test.form, test.outcome)
+		postForm(mux, test.target, test.body)
+		if got := submissionsTotal.Value(test.form, test.outcome) - before; got != 1 {
+			t.Errorf("Expected %v, got %v for %s", 1, got, test.outcome)
+		}
+	}
+
+	before := spamChecksFailed.Value("contact", "honeypot")
+	postForm(mux, "/contact", "website=spam")
+	if got := spamChecksFailed.Value("contact", "honeypot") - before; got != 1 {
+		t.Errorf("Expected %v, got %v", 1, got)
+	}
+}
+
+func TestObserveCaptcha(t *testing.T) {
+	tests := []struct {
+		provider string
+		pass     bool
+		err      error
+		result   string
+	}{
+		{"turnstile", true, nil, "pass"},
+		{"turnstile", false, &antispam.VerifyError{Codes: []antispam.ErrorCode{antispam.ErrInvalidInputResponse}}, "fail"},
+		{"recaptcha", false, antispam.ErrScoreTooLow, "fail"},
+		{"pow", false, errors.New("incorrect solution"), "fail"},
+		{"hcaptcha", false, errors.New("HTTP 503"), "error"},
+	}
+	for _, test := range tests {
+		before := captchaVerifyDuration.Count(test.provider, test.result)
+		errorsBefore := captchaVerifyErrors.Value(test.provider)
+		observeCaptcha(test.provider, time.Now(), test.pass, test.err)
+		if got := captchaVerifyDuration.Count(test.provider, test.result) - before; got != 1 {
+			t.Errorf("Expected %v, got %v for %s %s", 1, got, test.provider, test.result)
+		}
+		errorCount := captchaVerifyErrors.Value(test.provider) - errorsBefore
+		if expected := test.result == "error"; (errorCount == 1) != expected {
+			t.Errorf("Expected error counted %v, got %v", expected, errorCount)
+		}
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", registry.Handler())
+	mux.HandleFunc("GET /{id}/token", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := middleware.Instrument(mux, observeRequest)
+
+	before := httpRequestDuration.Count("GET /{id}/token", "418")
+	unmatched := httpRequestDuration.Count("unmatched", "404")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/contact/token", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a/b/c", nil))
+	if got := httpRequestDuration.Count("GET /{id}/token", "418") - before; got != 1 {
+		t.Errorf("Expected %v, got %v", 1, got)
+	}
+	if got := httpRequestDuration.Count("unmatched", "404") - unmatched; got != 1 {
+		t.Errorf("Expected %v, got %v", 1, got)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Expected the Prometheus content type, got %v", w.Header().Get("Content-Type"))
+	}
+	expected := `fohago_http_request_duration_seconds_count{route="GET /{id}/token",code="418"}`
+	if !strings.Contains(w.Body.String(), expected) {
+		t.Errorf("Expected %v in the metrics", expected)
+	}
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// headers whose values are replaced before they are logged
+var sensitiveHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+	"X-Auth-Token",
+}
+
+// RedactHeaders returns a copy of the headers with credentials and cookies redacted
+func RedactHeaders(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, name := range sensitiveHeaders {
+		if _, exists := redacted[name]; exists {
+			redacted[name] = []string{"[REDACTED]"}
+		}
+	}
+	return redacted
+}
+
+type clientIPKey struct{}
+
+// SetClientIP records the client IP a handler resolved behind trusted
+// proxies, for the access log entry of the request
+func SetClientIP(ctx context.Context, ip string) {
+	if clientIP, ok := ctx.Value(clientIPKey{}).(*string); ok {
+		*clientIP = ip
+	}
+}
+
+// Logging writes requests to the access log once they are served, except for
+// the skipped paths. Entries have the status, size and duration of the
+// response, the client IP set by SetClientIP or else the remote address, and
+// the redacted request headers if the logger is enabled for Debug.
+func Logging(next http.Handler, accessLogger *slog.Logger, skip ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slices.Contains(skip, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w}
+		var clientIP string
+		r = r.WithContext(context.WithValue(r.Context(), clientIPKey{}, &clientIP))
+		next.ServeHTTP(rw, r)
+
+		ctx := r.Context()
+		if !accessLogger.Enabled(ctx, slog.LevelInfo) {
+			return
+		}
+		remote := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(remote); err == nil {
+			remote = host
+		}
+		// entries are timed when the request was received, like Apache's %t
+		record := slog.NewRecord(start, slog.LevelInfo, "request", 0)
+		record.AddAttrs(
+			slog.String("remote_addr", remote),
+			slog.String("client_ip", cmp.Or(clientIP, remote)),
+			slog.String("method", r.Method),
+			slog.String("uri", r.RequestURI),
+			slog.String("proto", r.Proto),
+			slog.Int("status", rw.Status()),
+			slog.Int64("size", rw.size),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("request_id", RequestID(ctx)),
+			slog.String("referer", r.Referer()),
+			slog.String("user_agent", r.UserAgent()),
+		)
+		if accessLogger.Enabled(ctx, slog.LevelDebug) {
+			record.AddAttrs(slog.Any("headers", RedactHeaders(r.Header)))
+		}
+		accessLogger.Handler().Handle(ctx, record)
+	})
+}
+
+// CombinedHandler is a slog.Handler that writes the entries of Logging in
+// the Combined Log Format of Apache and nginx
+type CombinedHandler struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func NewCombinedHandler(w io.Writer) *CombinedHandler {
+	return &CombinedHandler{mu: &sync.Mutex{}, w: w}
+}
+
+func (h *CombinedHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo
+}
+
+func (h *CombinedHandler) Handle(_ context.Context, record slog.Record) error {
+	fields := map[string]slog.Value{}
+	record.Attrs(func(attr slog.Attr) bool {
+		fields[attr.Key] = attr.Value.Resolve()
+		return true
+	})
+	field := func(key string) string {
+		if value, exists := fields[key]; exists && value.String() != "" {
+			return value.String()
+		}
+		return "-"
+	}
+	host := field("client_ip")
+	if host == "-" {
+		host = field("remote_addr")
+	}
+	size := field("size")
+	if size == "0" {
+		size = "-"
+	}
+	request := fields["method"].String() + " " + fields["uri"].String() + " " + fields["proto"].String()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := fmt.Fprintf(h.w, "%s - - [%s] %s %s %s %s %s\n",
+		host,
+		record.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(request),
+		field("status"),
+		size,
+		strconv.Quote(field("referer")),
+		strconv.Quote(field("user_agent")),
+	)
+	return err
+}
+
+// WithAttrs returns the handler unchanged, the format has no room for more attributes
+func (h *CombinedHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *CombinedHandler) WithGroup(string) slog.Handler {
+	return h
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	handler := RequestIDs(Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}), logger, "/healthz"))
+
+	r := httptest.NewRequest("POST", "/contact", nil)
+	r.Header.Set("Cookie", "session=secret")
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set(RequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	var entry struct {
+		Status    int                 `json:"status"`
+		Size      int64               `json:"size"`
+		Duration  int64               `json:"duration"`
+		RequestID string              `json:"request_id"`
+		ClientIP  string              `json:"client_ip"`
+		Headers   map[string][]string `json:"headers"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Status != http.StatusCreated {
+		t.Errorf("Expected %v, got %v", http.StatusCreated, entry.Status)
+	}
+	if entry.Size != 5 {
+		t.Errorf("Expected %v, got %v", 5, entry.Size)
+	}
+	if entry.RequestID != "abc-123" || w.Header().Get(RequestIDHeader) != "abc-123" {
+		t.Errorf("Expected %v, got %v", "abc-123", entry.RequestID)
+	}
+	if entry.ClientIP != "192.0.2.1" {
+		t.Errorf("Expected %v, got %v", "192.0.2.1", entry.ClientIP)
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Errorf("Expected credentials to be redacted, got %v", buf.String())
+	}
+	if got := entry.Headers["Cookie"]; len(got) != 1 || got[0] != "[REDACTED]" {
+		t.Errorf("Expected %v, got %v", "[REDACTED]", got)
+	}
+
+	buf.Reset()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+	if buf.Len() != 0 {
+		t.Errorf("Expected skipped path not to be logged, got %v", buf.String())
+	}
+}
+
+func TestLoggingCombined(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewCombinedHandler(&buf))
+	handler := Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetClientIP(r.Context(), "192.0.2.1")
+		w.Write([]byte("hello"))
+	}), logger)
+
+	r := httptest.NewRequest("GET", `/a"b`, nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("User-Agent", "test/1.0")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	line := regexp.MustCompile(`^192\.0\.2\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /a\\"b HTTP/1\.1" 200 5 "-" "test/1\.0"\n$`)
+	if !line.MatchString(buf.String()) {
+		t.Errorf("Expected a Combined Log Format line, got %v", buf.String())
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	var id string
+	handler := RequestIDs(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = RequestID(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		expected bool
+	}{
+		{"Propagated", "req-42", true},
+		{"Missing", "", false},
+		{"Invalid characters", "bad id\n", false},
+		{"Too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if test.header != "" {
+				r.Header.Set(RequestIDHeader, test.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if (id == test.header) != test.expected {
+				t.Errorf("Expected propagated %v, got %v", test.expected, id)
+			}
+			if id == "" || w.Header().Get(RequestIDHeader) != id {
+				t.Errorf("Expected %v, got %v", id, w.Header().Get(RequestIDHeader))
+			}
+		})
+	}
+}
@@ -4,10 +4,11 @@ import (
 	"log/slog"
 	"net/http"
 	"runtime/debug"
+	"time"
 )
 
 // PanicRecovery is a middleware that recovers from panics while logging the error and returning an internal server error.
-// It should be the first middleware in the chain.
+// It should run inside Logging so the access log records the error response.
 // https://eli.thegreenplace.net/2021/rest-servers-in-go-part-5-middleware/
 func PanicRecovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -15,10 +16,12 @@ func PanicRecovery(next http.Handler) http.Handler {
 			if err := recover(); err != nil {
 				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 				slog.Error("Server panic:",
-					slog.String("Request method:", r.Method),
-					slog.String("URI:", r.RequestURI),
-					slog.String("Remote address:", r.RemoteAddr),
-					slog.Any("Headers:", r.Header),
+					slog.Any("error", err),
+					slog.String("method", r.Method),
+					slog.String("uri", r.RequestURI),
+					slog.String("remote_addr", r.RemoteAddr),
+					slog.String("request_id", RequestID(r.Context())),
+					slog.Any("headers", RedactHeaders(r.Header)),
 				)
 				slog.Debug("HTTP handler panic:", slog.Any("debug", debug.Stack()))
 			}
@@ -27,15 +30,50 @@ func PanicRecovery(next http.Handler) http.Handler {
 	})
 }
 
-func Logging(next http.Handler, accessLogger *slog.Logger) http.Handler {
+// responseWriter records the status code and size of a response
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.size += int64(n)
+	return n, err
+}
 
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Status returns the response status, 200 if the handler wrote nothing
+func (rw *responseWriter) Status() int {
+	if rw.status == 0 {
+		return http.StatusOK
+	}
+	return rw.status
+}
+
+// Instrument calls observe with the route pattern, status and duration of
+// each request. It must wrap the ServeMux directly so the pattern the mux
+// matched is set on the request.
+func Instrument(next http.Handler, observe func(route string, status int, duration time.Duration)) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		accessLogger.Debug("",
-			slog.String("Request method:", r.Method),
-			slog.String("URI:", r.RequestURI),
-			slog.String("Remote address:", r.RemoteAddr),
-			slog.Any("Headers:", r.Header),
-		)
-		next.ServeHTTP(w, r)
+		start := time.Now()
+		rw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+		observe(r.Pattern, rw.Status(), time.Since(start))
 	})
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// normalizeText prepares text for blocklist matching: it lowercases, folds
+// compatibility forms (fullwidth, mathematical alphanumerics), strips accents
+// and combining marks, removes invisible characters and maps common homoglyphs
+// from other scripts to their Latin lookalikes.
+func normalizeText(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		r = foldCompat(r)
+		if isInvisible(r) || unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		r = unicode.ToLower(r)
+		if base, ok := accentFold[r]; ok {
+			b.WriteString(base)
+			continue
+		}
+		if ascii, ok := homoglyphs[r]; ok {
+			r = ascii
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// foldCompat maps fullwidth and mathematical alphanumeric characters to ASCII
+func foldCompat(r rune) rune {
+	switch {
+	case r >= 0xFF01 && r <= 0xFF5E:
+		// fullwidth ASCII variants
+		return r - 0xFEE0
+	case r == 0x3000:
+		return ' '
+	case r >= 0x1D400 && r <= 0x1D6A3:
+		// mathematical alphanumeric letters come in alphabets of 52
+		offset := (r - 0x1D400) % 52
+		if offset < 26 {
+			return 'A' + offset
+		}
+		return 'a' + offset - 26
+	case r >= 0x1D7CE && r <= 0x1D7FF:
+		// mathematical digits come in sets of 10
+		return '0' + (r-0x1D7CE)%10
+	case r >= 0x24B6 && r <= 0x24CF:
+		// circled letters
+		return 'A' + (r - 0x24B6)
+	case r >= 0x24D0 && r <= 0x24E9:
+		return 'a' + (r - 0x24D0)
+	}
+	return r
+}
+
+func isInvisible(r rune) bool {
+	switch r {
+	case 0x00AD, 0x034F, 0x180E, 0x200B, 0x200C, 0x200D, 0x2060, 0xFEFF:
+		return true
+	}
+	return false
+}
+
+// accentFold maps precomposed Latin letters to their unaccented base letters
+var accentFold = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae", 'ç': "c", 'ć': "c", 'ĉ': "c", 'ċ': "c", 'č': "c", 'ď': "d", 'đ': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ĕ': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ĝ': "g", 'ğ': "g", 'ġ': "g", 'ģ': "g", 'ĥ': "h", 'ħ': "h",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ĩ': "i", 'ī': "i", 'ĭ': "i", 'į': "i", 'ı': "i",
+	'ĵ': "j", 'ķ': "k", 'ĺ': "l", 'ļ': "l", 'ľ': "l", 'ŀ': "l", 'ł': "l",
+	'ñ': "n", 'ń': "n", 'ņ': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ŏ': "o", 'ő': "o", 'œ': "oe",
+	'ŕ': "r", 'ŗ': "r", 'ř': "r", 'ś': "s", 'ŝ': "s", 'ş': "s", 'š': "s", 'ß': "ss",
+	'ţ': "t", 'ť': "t", 'ŧ': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ũ': "u", 'ū': "u", 'ŭ': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ŵ': "w", 'ý': "y", 'ÿ': "y", 'ŷ': "y", 'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+// homoglyphs maps lowercase Cyrillic and Greek letters that look like Latin letters
+var homoglyphs = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'һ': 'h', 'і': 'i', 'ї': 'i', 'ј': 'j', 'к': 'k',
+	'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c', 'ѕ': 's', 'т': 't', 'у': 'y', 'х': 'x',
+	'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ү': 'y',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+}
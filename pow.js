@@ -0,0 +1,67 @@
+// fohago proof-of-work widget
+//
+// Add data-fohago-pow to a form with the URL of the challenge endpoint:
+//
+//   <form method="post" action="https://fohago.example.com/contact"
+//         data-fohago-pow="https://fohago.example.com/contact/challenge">
+//   <script src="https://fohago.example.com/pow.js" defer></script>
+//
+// The widget fetches a challenge, finds the solution in the background and
+// submits it in the "altcha" field. Submit buttons are disabled until solved.
+(function () {
+  "use strict";
+
+  async function sha256(text) {
+    const digest = await crypto.subtle.digest("SHA-256", new TextEncoder().encode(text));
+    return Array.from(new Uint8Array(digest), (b) => b.toString(16).padStart(2, "0")).join("");
+  }
+
+  async function solve(challenge) {
+    for (let n = 0; n <= challenge.maxnumber; n++) {
+      if ((await sha256(challenge.salt + n)) === challenge.challenge) {
+        return n;
+      }
+    }
+    throw new Error("no solution found");
+  }
+
+  async function protect(form) {
+    const buttons = form.querySelectorAll("[type=submit]");
+    buttons.forEach((b) => (b.disabled = true));
+
+    let input = form.querySelector("input[name=altcha]");
+    if (!input) {
+      input = document.createElement("input");
+      input.type = "hidden";
+      input.name = "altcha";
+      form.appendChild(input);
+    }
+
+    try {
+      const resp = await fetch(form.dataset.fohagoPow, { cache: "no-store" });
+      const challenge = await resp.json();
+      const number = await solve(challenge);
+      input.value = btoa(JSON.stringify({
+        algorithm: challenge.algorithm,
+        challenge: challenge.challenge,
+        number: number,
+        salt: challenge.salt,
+        signature: challenge.signature,
+      }));
+    } catch (err) {
+      console.error("fohago: proof-of-work failed", err);
+    } finally {
+      buttons.forEach((b) => (b.disabled = false));
+    }
+  }
+
+  function init() {
+    document.querySelectorAll("form[data-fohago-pow]").forEach(protect);
+  }
+
+  if (document.readyState === "loading") {
+    document.addEventListener("DOMContentLoaded", init);
+  } else {
+    init();
+  }
+})();
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quarantine stores submissions that scored as likely spam so false
+// positives can be recovered
+type Quarantine struct {
+	Dir      string
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// QuarantinedSubmission is the stored form of a quarantined submission
+type QuarantinedSubmission struct {
+	Id        string     `json:"id"`
+	Form      string     `json:"form"`
+	Received  time.Time  `json:"received"`
+	Body      FormBody   `json:"body"`
+	UserAgent string     `json:"userAgent"`
+	UserIP    string     `json:"userIP"`
+	Referrer  string     `json:"referrer"`
+	Country   string     `json:"country,omitempty"`
+	Spam      SpamResult `json:"spam"`
+}
+
+func NewQuarantine(conf *Config) *Quarantine {
+	dir := conf.Global.Quarantine.Dir
+	if dir == "" {
+		dir = "quarantine"
+	}
+	return &Quarantine{Dir: dir}
+}
+
+// newSubmissionId returns a random identifier for a stored submission
+func newSubmissionId() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Store saves a submission as JSON in a directory per form and returns its id
+func (q *Quarantine) Store(sub FormSubmission, result SpamResult) (string, error) {
+	record := QuarantinedSubmission{
+		Id:        newSubmissionId(),
+		Form:      sub.Id,
+		Received:  time.Now().UTC(),
+		Body:      sub.Body,
+		UserAgent: sub.UserAgent,
+		UserIP:    sub.UserIP,
+		Referrer:  sub.Referrer,
+		Country:   sub.Country,
+		Spam:      result,
+	}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(q.Dir, filepath.Base(sub.Id))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return record.Id, os.WriteFile(filepath.Join(dir, record.Id+".json"), data, 0o600)
+}
+
+// Load reads a quarantined submission
+func (q *Quarantine) Load(form string, id string) (QuarantinedSubmission, error) {
+	var record QuarantinedSubmission
+	data, err := os.ReadFile(filepath.Join(q.Dir, filepath.Base(form), filepath.Base(id)+".json"))
+	if err != nil {
+		return record, err
+	}
+	err = json.Unmarshal(data, &record)
+	return record, err
+}
+
+// Delete removes a quarantined submission
+func (q *Quarantine) Delete(form string, id string) error {
+	return os.Remove(filepath.Join(q.Dir, filepath.Base(form), filepath.Base(id)+".json"))
+}
+
+// Take loads and removes a quarantined submission. Of concurrent calls for
+// the same submission only one succeeds, the others get an error.
+func (q *Quarantine) Take(form string, id string) (QuarantinedSubmission, error) {
+	record, err := q.Load(form, id)
+	if err != nil {
+		return record, err
+	}
+	if err := q.Delete(form, id); err != nil {
+		return QuarantinedSubmission{}, err
+	}
+	return record, nil
+}
+
+// pruneEvery removes submissions older than maxAge on every tick until Close
+func (q *Quarantine) pruneEvery(interval time.Duration, maxAge time.Duration) {
+	q.stop = make(chan struct{})
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := q.Prune(time.Now().Add(-maxAge)); err != nil {
+					slog.Warn("Could not prune stored submissions:", slog.String("dir", q.Dir), slog.Any("error", err))
+				}
+			case <-q.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops pruning
+func (q *Quarantine) Close() {
+	if q.stop != nil {
+		q.stopOnce.Do(func() { close(q.stop) })
+	}
+}
+
+// List returns the ids of the quarantined submissions for a form
+func (q *Quarantine) List(form string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(q.Dir, filepath.Base(form)))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if id, found := strings.CutSuffix(entry.Name(), ".json"); found {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// Prune removes submissions stored before cutoff
+func (q *Quarantine) Prune(cutoff time.Time) error {
+	forms, err := os.ReadDir(q.Dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, form := range forms {
+		if !form.IsDir() {
+			continue
+		}
+		dir := filepath.Join(q.Dir, form.Name())
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil || !strings.HasSuffix(entry.Name(), ".json") || !info.ModTime().Before(cutoff) {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuarantine_Store(t *testing.T) {
+	q := &Quarantine{Dir: t.TempDir()}
+	sub := FormSubmission{
+		Id:        "contact",
+		Body:      FormBody{"message": "casino"},
+		UserAgent: "Mozilla/5.0",
+		UserIP:    "192.0.2.1",
+	}
+	result := SpamResult{
+		Score:   0.5,
+		Reasons: []SpamReason{{Check: "blocklist", Score: 0.5, Reason: "message contains blocklist term \"casino\""}},
+	}
+
+	id, err := q.Store(sub, result)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	record, err := q.Load("contact", id)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if record.Id != id || record.Form != "contact" || record.UserIP != "192.0.2.1" {
+		t.Errorf("Unexpected record %+v", record)
+	}
+	if !reflect.DeepEqual(record.Body, sub.Body) {
+		t.Errorf("Expected body %v, got %v", sub.Body, record.Body)
+	}
+	if !reflect.DeepEqual(record.Spam.Reasons, result.Reasons) {
+		t.Errorf("Expected reasons %v, got %v", result.Reasons, record.Spam.Reasons)
+	}
+}
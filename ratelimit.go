@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits submissions with a token bucket per form and client IP.
+type RateLimiter struct {
+	global RateLimitConfig
+	mu     sync.Mutex
+	bucket map[string]*tokenBucket
+	file   string
+	// buckets idle for longer than maxIdle are full and can be dropped
+	maxIdle   time.Duration
+	lastPrune time.Time
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+type tokenBucket struct {
+	Tokens float64   `json:"tokens"`
+	Last   time.Time `json:"last"`
+}
+
+// how often the file backend writes the bucket state to disk
+const rateLimitFlushInterval = 30 * time.Second
+
+func NewRateLimiter(conf *Config) *RateLimiter {
+	rl := &RateLimiter{
+		global: conf.Global.RateLimit.RateLimitConfig,
+		bucket: make(map[string]*tokenBucket),
+	}
+	rl.maxIdle = refillTime(rl.global)
+	for _, form := range conf.Forms {
+		rl.maxIdle = max(rl.maxIdle, refillTime(rl.limitFor(form)))
+	}
+	if conf.Global.RateLimit.Backend == "file" {
+		rl.file = conf.Global.RateLimit.File
+		if rl.file == "" {
+			rl.file = "ratelimit.json"
+		}
+		if err := rl.load(); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Could not load rate limit state:", slog.Any("error", err))
+		}
+		rl.stop = make(chan struct{})
+		go rl.flush(time.NewTicker(rateLimitFlushInterval))
+	}
+	return rl
+}
+
+// flush saves the bucket state on every tick until Close
+func (rl *RateLimiter) flush(ticker *time.Ticker) {
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := rl.Save(); err != nil {
+				slog.Warn("Could not save rate limit state:", slog.Any("error", err))
+			}
+		case <-rl.stop:
+			return
+		}
+	}
+}
+
+// Close stops the periodic flush and saves the bucket state a last time
+func (rl *RateLimiter) Close() error {
+	if rl.stop != nil {
+		rl.stopOnce.Do(func() { close(rl.stop) })
+	}
+	return rl.Save()
+}
+
+// limitFor returns the limit for a form, falling back to the global limit.
+// A form that only sets requests uses the global period.
+func (rl *RateLimiter) limitFor(formCfg FormConfig) RateLimitConfig {
+	limit := formCfg.RateLimit
+	if limit.Requests <= 0 {
+		return rl.global
+	}
+	if limit.Period <= 0 {
+		limit.Period = rl.global.Period
+	}
+	return limit
+}
+
+// Allow takes a token from the bucket for the form and client IP.
+// If the bucket is empty it returns false and how long until a token is available.
+func (rl *RateLimiter) Allow(id string, formCfg FormConfig, ip string, now time.Time) (bool, time.Duration) {
+	limit := rl.limitFor(formCfg)
+	if limit.Requests <= 0 || limit.Period <= 0 {
+		return true, 0
+	}
+	burst := float64(burstOf(limit))
+	rate := float64(limit.Requests) / limit.Period.Seconds()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if now.Sub(rl.lastPrune) > rl.maxIdle {
+		rl.prune(now)
+	}
+
+	key := id + " " + ip
+	b, exists := rl.bucket[key]
+	if !exists {
+		b = &tokenBucket{Tokens: burst, Last: now}
+		rl.bucket[key] = b
+	}
+	if elapsed := now.Sub(b.Last).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(burst, b.Tokens+elapsed*rate)
+		b.Last = now
+	}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.Tokens) / rate * float64(time.Second))
+	return false, wait
+}
+
+// burstOf returns the bucket size, which defaults to Requests
+func burstOf(limit RateLimitConfig) int {
+	if limit.Burst < 1 {
+		return limit.Requests
+	}
+	return limit.Burst
+}
+
+// refillTime returns how long an empty bucket takes to fill up
+func refillTime(limit RateLimitConfig) time.Duration {
+	if limit.Requests <= 0 {
+		return 0
+	}
+	return limit.Period * time.Duration(burstOf(limit)) / time.Duration(limit.Requests)
+}
+
+// prune drops buckets that have been idle long enough to be full again
+func (rl *RateLimiter) prune(now time.Time) {
+	for key, b := range rl.bucket {
+		if now.Sub(b.Last) > rl.maxIdle {
+			delete(rl.bucket, key)
+		}
+	}
+	rl.lastPrune = now
+}
+
+// Save writes the bucket state to the file backend, if configured
+func (rl *RateLimiter) Save() error {
+	if rl.file == "" {
+		return nil
+	}
+	rl.mu.Lock()
+	rl.prune(time.Now())
+	data, err := json.Marshal(rl.bucket)
+	rl.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(rl.file, data, 0o600)
+}
+
+func (rl *RateLimiter) load() error {
+	data, err := os.ReadFile(rl.file)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &rl.bucket)
+}
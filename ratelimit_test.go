@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	conf := &Config{}
+	conf.Global.RateLimit.Requests = 2
+	conf.Global.RateLimit.Period = time.Minute
+	rl := NewRateLimiter(conf)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := rl.Allow("contact", FormConfig{}, "192.0.2.1", now); !allowed {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+	allowed, wait := rl.Allow("contact", FormConfig{}, "192.0.2.1", now)
+	if allowed {
+		t.Errorf("Expected third request to be limited")
+	}
+	if wait != 30*time.Second {
+		t.Errorf("Expected wait of 30s, got %v", wait)
+	}
+
+	// other IPs and forms have their own bucket
+	if allowed, _ := rl.Allow("contact", FormConfig{}, "192.0.2.2", now); !allowed {
+		t.Errorf("Expected other IP to be allowed")
+	}
+	if allowed, _ := rl.Allow("quote", FormConfig{}, "192.0.2.1", now); !allowed {
+		t.Errorf("Expected other form to be allowed")
+	}
+
+	// tokens refill over time
+	if allowed, _ := rl.Allow("contact", FormConfig{}, "192.0.2.1", now.Add(30*time.Second)); !allowed {
+		t.Errorf("Expected request to be allowed after refill")
+	}
+}
+
+func TestRateLimiter_formOverride(t *testing.T) {
+	conf := &Config{}
+	rl := NewRateLimiter(conf)
+	now := time.Now()
+
+	if allowed, _ := rl.Allow("contact", FormConfig{}, "192.0.2.1", now); !allowed {
+		t.Errorf("Expected no limit without configuration")
+	}
+
+	formCfg := FormConfig{RateLimit: RateLimitConfig{Requests: 1, Period: time.Hour, Burst: 1}}
+	rl.Allow("contact", formCfg, "192.0.2.1", now)
+	if allowed, _ := rl.Allow("contact", formCfg, "192.0.2.1", now); allowed {
+		t.Errorf("Expected form limit to apply")
+	}
+
+	// requests without a period use the global period
+	conf.Global.RateLimit.Requests = 10
+	conf.Global.RateLimit.Period = time.Hour
+	rl = NewRateLimiter(conf)
+	formCfg = FormConfig{RateLimit: RateLimitConfig{Requests: 1}}
+	rl.Allow("contact", formCfg, "192.0.2.1", now)
+	if allowed, _ := rl.Allow("contact", formCfg, "192.0.2.1", now); allowed {
+		t.Errorf("Expected the form limit to apply with the global period")
+	}
+}
+
+func TestRateLimiter_Save(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ratelimit.json")
+	conf := &Config{}
+	conf.Global.RateLimit.Requests = 1
+	conf.Global.RateLimit.Period = time.Hour
+	conf.Global.RateLimit.Backend = "file"
+	conf.Global.RateLimit.File = file
+
+	rl := NewRateLimiter(conf)
+	rl.Allow("contact", FormConfig{}, "192.0.2.1", time.Now())
+	if err := rl.Save(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Fatalf("Expected state file, got %v", err)
+	}
+
+	// a new limiter picks up the saved state
+	rl = NewRateLimiter(conf)
+	if allowed, _ := rl.Allow("contact", FormConfig{}, "192.0.2.1", time.Now()); allowed {
+		t.Errorf("Expected saved bucket to be empty")
+	}
+}
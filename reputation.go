@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reputation counts how often submissions from an IP were marked as spam or
+// ham through feedback. IPv6 addresses are grouped by /64 since clients
+// usually get a whole prefix.
+type Reputation struct {
+	file string
+	mu   sync.Mutex
+	ips  map[string]*ipReputation
+}
+
+type ipReputation struct {
+	Spam    int       `json:"spam"`
+	Ham     int       `json:"ham"`
+	Updated time.Time `json:"updated"`
+}
+
+// NewReputation returns nil if no reputation file is configured
+func NewReputation(conf *Config) *Reputation {
+	if conf.Global.Reputation.File == "" {
+		return nil
+	}
+	rep := &Reputation{file: conf.Global.Reputation.File, ips: make(map[string]*ipReputation)}
+	data, err := os.ReadFile(rep.file)
+	if err == nil {
+		err = json.Unmarshal(data, &rep.ips)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		slog.Warn("Could not load IP reputation:", slog.Any("error", err))
+	}
+	return rep
+}
+
+// reputationKey returns the IP, or its /64 prefix for IPv6
+func reputationKey(ip string) (string, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+	addr = addr.Unmap()
+	if addr.Is6() {
+		prefix, _ := addr.Prefix(64)
+		return prefix.String(), true
+	}
+	return addr.String(), true
+}
+
+// Record adds a spam or ham verdict for an IP and saves the counts
+func (rep *Reputation) Record(ip string, spam bool, now time.Time) error {
+	key, ok := reputationKey(ip)
+	if !ok {
+		return nil
+	}
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	entry, exists := rep.ips[key]
+	if !exists {
+		entry = &ipReputation{}
+		rep.ips[key] = entry
+	}
+	if spam {
+		entry.Spam++
+	} else {
+		entry.Ham++
+	}
+	entry.Updated = now
+	data, err := json.Marshal(rep.ips)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(rep.file, data, 0o600)
+}
+
+// Counts returns how often submissions from an IP were marked as spam and ham
+func (rep *Reputation) Counts(ip string) (spam int, ham int) {
+	key, ok := reputationKey(ip)
+	if !ok {
+		return 0, 0
+	}
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	if entry, exists := rep.ips[key]; exists {
+		return entry.Spam, entry.Ham
+	}
+	return 0, 0
+}
+
+// reputation scores IPs that were reported as spam more often than as ham.
+// The score approaches 1 with every report.
+func (c *Check) reputation(sub FormSubmission, fh FormHandler) (float64, error) {
+	if fh.Reputation == nil {
+		return 0, nil
+	}
+	spam, ham := fh.Reputation.Counts(sub.UserIP)
+	if spam <= ham {
+		return 0, nil
+	}
+	p := float64(spam) / float64(spam+ham+1)
+	return p, fmt.Errorf("IP reported as spam %d times", spam)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReputation(t *testing.T) {
+	conf := &Config{}
+	conf.Global.Reputation.File = filepath.Join(t.TempDir(), "reputation.json")
+	rep := NewReputation(conf)
+	now := time.Now()
+
+	rep.Record("192.0.2.1", true, now)
+	rep.Record("192.0.2.1", true, now)
+	rep.Record("192.0.2.1", false, now)
+	rep.Record("2001:db8:1:2::1", true, now)
+	rep.Record("not an ip", true, now)
+
+	if spam, ham := rep.Counts("192.0.2.1"); spam != 2 || ham != 1 {
+		t.Errorf("Expected 2 spam and 1 ham, got %v and %v", spam, ham)
+	}
+	if spam, _ := rep.Counts("2001:db8:1:2:ffff::9"); spam != 1 {
+		t.Errorf("Expected the /64 to share a reputation, got %v spam", spam)
+	}
+	if spam, _ := rep.Counts("2001:db8:1:3::1"); spam != 0 {
+		t.Errorf("Expected another /64 to have no reports, got %v spam", spam)
+	}
+
+	// counts are kept across restarts
+	rep = NewReputation(conf)
+	if spam, ham := rep.Counts("192.0.2.1"); spam != 2 || ham != 1 {
+		t.Errorf("Expected 2 spam and 1 ham after reload, got %v and %v", spam, ham)
+	}
+}
+
+func TestCheck_reputation(t *testing.T) {
+	conf := &Config{}
+	conf.Global.Reputation.File = filepath.Join(t.TempDir(), "reputation.json")
+	fh := FormHandler{Config: conf, Reputation: NewReputation(conf)}
+	c := &Check{}
+	now := time.Now()
+	fh.Reputation.Record("192.0.2.1", true, now)
+	fh.Reputation.Record("192.0.2.2", true, now)
+	fh.Reputation.Record("192.0.2.2", false, now)
+
+	tests := []struct {
+		ip       string
+		expected float64
+	}{
+		{"192.0.2.1", 0.5},
+		{"192.0.2.2", 0},
+		{"192.0.2.3", 0},
+	}
+	for _, test := range tests {
+		p, err := c.reputation(FormSubmission{UserIP: test.ip}, fh)
+		if p != test.expected {
+			t.Errorf("%s: Expected %v, got %v", test.ip, test.expected, p)
+		}
+		if p > 0 && err == nil {
+			t.Errorf("%s: Expected an error explaining the score", test.ip)
+		}
+	}
+}
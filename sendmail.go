@@ -2,9 +2,13 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"html/template"
+	"log/slog"
 	"net/smtp"
+	"net/textproto"
+	"time"
 )
 
 type message struct {
@@ -18,33 +22,56 @@ type message struct {
 func buildAndSend(cfg *Config, sub FormSubmission) error {
 	msg, err := buildEmailMessage(sub)
 	if err != nil {
-		fmt.Println("Failed to build email message:", err)
+		sub.logger().Error("Failed to build email message:", slog.Any("error", err))
 		return err
 	}
 
+	start := time.Now()
 	err = sendEmail(cfg, msg)
+	duration := time.Since(start)
+	result := "success"
 	if err != nil {
-		fmt.Println("Failed to send email:", err)
+		result = "error"
+	}
+	smtpSendDuration.Observe(duration.Seconds(), result)
+	if err != nil {
+		attrs := []any{slog.String("smtp_host", cfg.Smtp.Host), slog.Any("smtp_error", err)}
+		var smtpErr *textproto.Error
+		if errors.As(err, &smtpErr) {
+			attrs = append(attrs, slog.Int("smtp_code", smtpErr.Code))
+		}
+		sub.logger().Error("Failed to send email:", attrs...)
 		return err
 	}
 
-	fmt.Println("Email sent successfully!")
+	sub.logger().Info("Email sent:", slog.Duration("duration", duration))
 	return nil
 }
 
 func buildEmailMessage(sub FormSubmission) (message, error) {
-	tmpl := loadTemplate(sub.Id)
+	tmpl, err := loadTemplate(sub.Id)
+	if err != nil {
+		return message{}, err
+	}
 
 	var body bytes.Buffer
 	if err := tmpl.ExecuteTemplate(&body, sub.Id+".html", sub.Body); err != nil {
 		return message{}, err
 	}
+	if sub.FeedbackURL != "" {
+		if err := feedbackLinks.Execute(&body, sub.FeedbackURL); err != nil {
+			return message{}, err
+		}
+	}
 
 	headers := "From: <" + sub.FormCfg.Mail.Sender + ">\r\n" +
 		"To: <" + sub.FormCfg.Mail.Recipient + ">\r\n" +
 		"Subject: " + sub.FormCfg.Mail.Subject + " - " + sub.Id + "\r\n" +
-		"Reply-To: <" + sub.Body[sub.FormCfg.Fields.Email] + ">\r\n" +
-		"MIME-version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n"
+		"Reply-To: <" + sub.Body[sub.FormCfg.Fields.Email] + ">\r\n"
+	if sub.Country != "" {
+		headers += "X-Fohago-Country: " + sub.Country + "\r\n"
+	}
+	headers += "MIME-version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n\r\n"
 
 	return message{
 		Subject:   sub.FormCfg.Mail.Subject + " - " + sub.Id,
@@ -55,6 +82,10 @@ func buildEmailMessage(sub FormSubmission) (message, error) {
 	}, nil
 }
 
+var feedbackLinks = template.Must(template.New("feedback").Parse(
+	`<p style="font-size:small"><a href="{{.}}/spam">Mark as spam</a> · <a href="{{.}}/ham">Not spam</a></p>`,
+))
+
 func sendEmail(cfg *Config, message message) error {
 	auth := smtp.PlainAuth("", cfg.Smtp.User, cfg.Smtp.Password, cfg.Smtp.Host)
 	err := smtp.SendMail(fmt.Sprintf("%s:%d", cfg.Smtp.Host, cfg.Smtp.Port), auth, message.Sender, []string{message.Recipient}, message.Body)
@@ -65,18 +96,17 @@ func sendEmail(cfg *Config, message message) error {
 	return nil
 }
 
-func loadTemplate(id string) *template.Template {
+func loadTemplate(id string) (*template.Template, error) {
 	defaultTemplate, err := template.New("default").ParseFiles("forms/default.html")
 	if err != nil {
-		fmt.Println("Failed to parse default template:", err)
-		return nil
+		return nil, fmt.Errorf("default template: %w", err)
 	}
 
 	template, err := template.ParseFiles(fmt.Sprintf("forms/%s.html", id))
 	if err != nil {
-		fmt.Println("Failed to parse template:", err)
-		return defaultTemplate
+		slog.Warn("Failed to parse form template, using the default:", slog.String("form", id), slog.Any("error", err))
+		return defaultTemplate, nil
 	}
 
-	return template
+	return template, nil
 }
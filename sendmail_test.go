@@ -156,8 +156,8 @@ func TestSendEmail(t *testing.T) {
 func TestLoadTemplate(t *testing.T) {
 	id := "example"
 
-	tmpl := loadTemplate(id)
-	if tmpl == nil {
-		t.Errorf("Expected template, got nil")
+	tmpl, err := loadTemplate(id)
+	if tmpl == nil || err != nil {
+		t.Errorf("Expected template, got %v", err)
 	}
 }
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultWriteTimeout      = 30 * time.Second
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultShutdownTimeout   = 30 * time.Second
+	defaultSocketMode        = 0o660
+)
+
+// first file descriptor passed by systemd socket activation
+const systemdFirstFd = 3
+
+func newServer(conf *Config, handler http.Handler) *http.Server {
+	cfg := conf.Global.Server
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: cmp.Or(cfg.ReadHeaderTimeout, defaultReadHeaderTimeout),
+		ReadTimeout:       cmp.Or(cfg.ReadTimeout, defaultReadTimeout),
+		WriteTimeout:      cmp.Or(cfg.WriteTimeout, defaultWriteTimeout),
+		IdleTimeout:       cmp.Or(cfg.IdleTimeout, defaultIdleTimeout),
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// listen opens the configured TCP address, Unix socket or systemd socket
+func listen(conf *Config) (net.Listener, error) {
+	cfg := conf.Global.Server
+	switch {
+	case cfg.Listen == "systemd":
+		return systemdListener()
+	case strings.HasPrefix(cfg.Listen, "unix:"):
+		path := strings.TrimPrefix(cfg.Listen, "unix:")
+		// remove the socket left behind by a previous run
+		if info, err := os.Stat(path); err == nil && info.Mode().Type() == os.ModeSocket {
+			os.Remove(path)
+		}
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, cmp.Or(cfg.SocketMode, defaultSocketMode)); err != nil {
+			ln.Close()
+			return nil, err
+		}
+		return ln, nil
+	case cfg.Listen != "":
+		return net.Listen("tcp", cfg.Listen)
+	}
+	return net.Listen("tcp", ":"+strconv.Itoa(conf.Global.Port))
+}
+
+// systemdListener returns the socket passed by systemd, see sd_listen_fds(3)
+func systemdListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errors.New("no socket passed by systemd")
+	}
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, errors.New("no socket passed by systemd")
+	}
+	if fds > 1 {
+		slog.Warn("Only the first socket passed by systemd is used:", slog.Int("sockets", fds))
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	syscall.CloseOnExec(systemdFirstFd)
+	f := os.NewFile(systemdFirstFd, "systemd")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// serve runs the server until it fails or ctx is done, then shuts it down
+// gracefully: in-flight requests finish, then the mail queue is drained.
+// With TLS it also runs the HTTP to HTTPS redirect if configured.
+func serve(ctx context.Context, conf *Config, srv *http.Server, ln net.Listener, fh *FormHandler) error {
+	// ServeTLS modifies srv.TLSConfig, so it is not read once the server runs
+	useTLS := srv.TLSConfig != nil
+	redirectAddr := conf.Global.TLS.RedirectHTTP
+	slog.Info("Listening:", slog.String("address", ln.Addr().String()), slog.Bool("tls", useTLS))
+	errc := make(chan error, 2)
+	go func() {
+		if useTLS {
+			errc <- srv.ServeTLS(ln, "", "")
+			return
+		}
+		errc <- srv.Serve(ln)
+	}()
+
+	servers := []*http.Server{srv}
+	if useTLS && redirectAddr != "" {
+		redirect := &http.Server{
+			Addr:              redirectAddr,
+			Handler:           redirectToHTTPS(ln.Addr()),
+			ReadHeaderTimeout: srv.ReadHeaderTimeout,
+			IdleTimeout:       srv.IdleTimeout,
+			ErrorLog:          srv.ErrorLog,
+		}
+		servers = append(servers, redirect)
+		go func() {
+			slog.Info("Redirecting HTTP to HTTPS:", slog.String("address", redirectAddr))
+			errc <- redirect.ListenAndServe()
+		}()
+	}
+
+	var err error
+	select {
+	case err = <-errc:
+		err = fmt.Errorf("server stopped: %w", err)
+	case <-ctx.Done():
+	}
+
+	timeout := cmp.Or(conf.Global.Server.ShutdownTimeout, defaultShutdownTimeout)
+	slog.Info("Shutting down:", slog.Duration("timeout", timeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, s := range servers {
+		if shutdownErr := s.Shutdown(shutdownCtx); shutdownErr != nil {
+			slog.Error("Requests did not finish in time:", slog.Any("error", shutdownErr))
+			err = errors.Join(err, shutdownErr)
+		}
+	}
+	return errors.Join(err, fh.Close(shutdownCtx))
+}
+
+// run serves until SIGINT or SIGTERM. SIGHUP reopens the log files and
+// reloads the TLS certificate.
+func run(conf *Config, handler http.Handler, fh *FormHandler, logs *Logs) error {
+	srv := newServer(conf, handler)
+	tlsConf, reloader, err := tlsConfig(conf)
+	if err != nil {
+		return fmt.Errorf("TLS: %w", err)
+	}
+	srv.TLSConfig = tlsConf
+	ln, err := listen(conf)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for range hup {
+			if err := logs.Reopen(); err != nil {
+				slog.Error("Could not reopen logs:", slog.Any("error", err))
+			}
+			if reloader != nil {
+				reloader.Reload()
+			}
+		}
+	}()
+	return serve(ctx, conf, srv, ln, fh)
+}
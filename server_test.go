@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServe_gracefulShutdown(t *testing.T) {
+	conf := &Config{}
+	conf.Global.Server.Listen = "unix:" + filepath.Join(t.TempDir(), "fohago.sock")
+	ln, err := listen(conf)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, conf, newServer(conf, handler), ln, &FormHandler{Config: conf})
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", ln.Addr().String())
+		},
+	}}
+	body := make(chan string, 1)
+	go func() {
+		resp, err := client.Get("http://fohago/")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		body <- string(data)
+	}()
+
+	<-started
+	cancel()
+	if got := <-body; got != "done" {
+		t.Errorf("Expected the in-flight request to finish, got %v", got)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Expected a clean shutdown, got %v", err)
+	}
+}
+
+func TestListen_systemdWithoutSocket(t *testing.T) {
+	conf := &Config{}
+	conf.Global.Server.Listen = "systemd"
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	if _, err := listen(conf); err == nil {
+		t.Error("Expected an error when the sockets are for another process")
+	}
+}
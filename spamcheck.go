@@ -3,8 +3,9 @@ package main
 import (
 	"errors"
 	"fmt"
-	"log"
-	"strings"
+	"log/slog"
+	"net/http"
+	"time"
 
 	"github.com/lkhrs/fohago/antispam"
 )
@@ -12,12 +13,39 @@ import (
 type Check struct{}
 
 func (c *Check) blocklist(sub FormSubmission, fh FormHandler) (bool, error) {
-	global := fh.Config.Global.Blocklist
-	form := sub.FormCfg.Blocklist
-	combined := append(global, form...)
-	for _, term := range combined {
-		if strings.Contains(sub.Body[sub.FormCfg.Fields.Message], term) {
-			return false, fmt.Errorf("message contains blocklist term \"%v\"", term)
+	global := fh.Config.Global
+	form := sub.FormCfg
+	rules := make([]BlockRule, 0, len(global.Blocklist)+len(form.Blocklist)+len(global.Rules)+len(form.Rules))
+	for _, term := range global.Blocklist {
+		rules = append(rules, parseBlockTerm(term))
+	}
+	for _, term := range form.Blocklist {
+		rules = append(rules, parseBlockTerm(term))
+	}
+	if fh.BlocklistFile != nil {
+		for _, term := range fh.BlocklistFile.Get() {
+			rules = append(rules, parseBlockTerm(term))
+		}
+	}
+	rules = append(rules, global.Rules...)
+	rules = append(rules, form.Rules...)
+
+	normalized := make(map[string]string)
+	for _, rule := range rules {
+		match := rule.matcher()
+		for _, field := range rule.fieldsFor(sub) {
+			value, exists := sub.Body[field]
+			if !exists || value == "" {
+				continue
+			}
+			text, done := normalized[field]
+			if !done {
+				text = normalizeText(value)
+				normalized[field] = text
+			}
+			if match(text) {
+				return false, fmt.Errorf("%s contains blocklist term \"%v\"", field, rule.Pattern)
+			}
 		}
 	}
 	return true, nil
@@ -32,30 +60,225 @@ func (c *Check) honeypot(sub FormSubmission) (bool, error) {
 	return true, nil
 }
 
-func (c *Check) turnstile(sub FormSubmission) (bool, error) {
-	if sub.FormCfg.TurnstileKey == "" {
+func (c *Check) captcha(sub FormSubmission, fh FormHandler) (bool, error) {
+	cfg := sub.FormCfg.Captcha
+	if cfg.Provider == "" {
+		if sub.FormCfg.TurnstileKey == "" {
+			return true, nil
+		}
+		// the legacy turnstileKey setting
+		cfg = CaptchaConfig{Provider: "turnstile", Secret: sub.FormCfg.TurnstileKey}
+	}
+	verifier, err := fh.captchaVerifier(cfg)
+	if err != nil {
+		return false, err
+	}
+	start := time.Now()
+	pass, err := verifier.Verify(sub.Body[captchaFields[cfg.Provider]], sub.UserIP)
+	observeCaptcha(cfg.Provider, start, pass, err)
+	return pass, err
+}
+
+func (c *Check) fillTime(sub FormSubmission, fh FormHandler) (bool, error) {
+	cfg := sub.FormCfg.FillTime
+	if cfg.Min <= 0 && cfg.Max <= 0 {
 		return true, nil
 	}
-	secret := sub.FormCfg.TurnstileKey
-	token := sub.Body["cf-turnstile-response"]
-	return antispam.Turnstile(secret, token)
+	return fh.formToken().Check(sub.Body[cfg.field()], sub.Id, cfg.Min, cfg.Max, time.Now())
+}
+
+type spamVerdict int
+
+const (
+	spamAccept spamVerdict = iota
+	spamQuarantine
+	spamReject
+)
+
+func (v spamVerdict) String() string {
+	switch v {
+	case spamQuarantine:
+		return "quarantine"
+	case spamReject:
+		return "reject"
+	}
+	return "accept"
+}
+
+// SpamReason records the score a failing check added and why
+type SpamReason struct {
+	Check  string  `json:"check"`
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason"`
 }
 
-// checkSpam checks the form submission for spam
-// returns true if the checks pass, false if spam is detected
-func (fh *FormHandler) checkSpam(sub FormSubmission) bool {
+// SpamResult is the outcome of the spam checks for a submission
+type SpamResult struct {
+	Score   float64      `json:"score"`
+	Reasons []SpamReason `json:"reasons"`
+	Verdict spamVerdict  `json:"-"`
+}
+
+// spamCheck is a named check returning how likely a submission is spam,
+// from 0 (ham) to 1 (spam). The score is multiplied by the check's weight.
+type spamCheck struct {
+	name string
+	run  func(sub FormSubmission) (float64, error)
+}
+
+// failScore converts a pass/fail check result to a score
+func failScore(pass bool, err error) (float64, error) {
+	if pass {
+		return 0, nil
+	}
+	return 1, err
+}
+
+func (fh *FormHandler) spamChecks() []spamCheck {
 	check := &Check{}
-	if pass, err := check.honeypot(sub); !pass {
-		log.Println("Honeypot check failed:", err)
-		return false
+	return []spamCheck{
+		{"geoip", func(sub FormSubmission) (float64, error) {
+			return failScore(check.geoip(sub))
+		}},
+		{"honeypot", func(sub FormSubmission) (float64, error) {
+			return failScore(check.honeypot(sub))
+		}},
+		{"blocklist", func(sub FormSubmission) (float64, error) {
+			return failScore(check.blocklist(sub, *fh))
+		}},
+		{"email", func(sub FormSubmission) (float64, error) {
+			return failScore(check.email(sub, *fh))
+		}},
+		{"heuristics", func(sub FormSubmission) (float64, error) {
+			return failScore(check.heuristics(sub))
+		}},
+		{"filltime", func(sub FormSubmission) (float64, error) {
+			return failScore(check.fillTime(sub, *fh))
+		}},
+		{"bayes", func(sub FormSubmission) (float64, error) {
+			return check.bayes(sub, *fh)
+		}},
+		{"reputation", func(sub FormSubmission) (float64, error) {
+			return check.reputation(sub, *fh)
+		}},
+		{"captcha", func(sub FormSubmission) (float64, error) {
+			return failScore(check.captcha(sub, *fh))
+		}},
+	}
+}
+
+// thresholds returns the reject and quarantine scores for a form
+func (cfg SpamConfig) thresholds() (reject float64, quarantine float64) {
+	reject = cfg.RejectScore
+	if reject <= 0 {
+		reject = 1
+	}
+	return reject, cfg.QuarantineScore
+}
+
+// weight returns the weight of a check, which defaults to 1
+func (cfg SpamConfig) weight(check string) float64 {
+	if weight, exists := cfg.Weights[check]; exists {
+		return weight
 	}
-	if pass, err := check.blocklist(sub, *fh); !pass {
-		log.Println(err)
-		return false
+	return 1
+}
+
+// captchaFields maps captcha providers to the form field holding the response token
+var captchaFields = map[string]string{
+	"turnstile": "cf-turnstile-response",
+	"hcaptcha":  "h-captcha-response",
+	"recaptcha": "g-recaptcha-response",
+	"pow":       "altcha",
+}
+
+// client returns an HTTP client with the configured timeout, or nil for the default
+func (cfg CaptchaConfig) client() *http.Client {
+	if cfg.Timeout <= 0 {
+		return nil
 	}
-	if pass, err := check.turnstile(sub); !pass {
-		log.Println("Turnstile check failed:", err)
-		return false
+	return &http.Client{Timeout: cfg.Timeout}
+}
+
+// captchaVerifier returns the verifier for the form's captcha provider
+func (fh *FormHandler) captchaVerifier(cfg CaptchaConfig) (antispam.Verifier, error) {
+	switch cfg.Provider {
+	case "pow":
+		return fh.proofOfWork(cfg), nil
+	case "turnstile":
+		return antispam.TurnstileVerifier{
+			Secret:   cfg.Secret,
+			Hostname: cfg.Hostname,
+			Action:   cfg.Action,
+			Endpoint: cfg.Endpoint,
+			Client:   cfg.client(),
+		}, nil
+	case "hcaptcha":
+		return antispam.HCaptcha{
+			Secret:   cfg.Secret,
+			SiteKey:  cfg.SiteKey,
+			Hostname: cfg.Hostname,
+			Endpoint: cfg.Endpoint,
+			Client:   cfg.client(),
+		}, nil
+	case "recaptcha":
+		return antispam.ReCaptcha{
+			Secret:   cfg.Secret,
+			MinScore: cfg.MinScore,
+			Hostname: cfg.Hostname,
+			Action:   cfg.Action,
+			Endpoint: cfg.Endpoint,
+			Client:   cfg.client(),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown captcha provider %q", cfg.Provider)
+}
+
+// checkSpam runs the spam checks on the form submission and adds up the
+// weighted score of the failing checks to decide whether to accept,
+// quarantine or reject it
+func (fh *FormHandler) checkSpam(sub FormSubmission) SpamResult {
+	result := SpamResult{}
+	if fh.IPFilter != nil {
+		switch fh.IPFilter.Match(sub.Id, sub.UserIP) {
+		case ipAllowed:
+			return result
+		case ipBlocked:
+			sub.logger().Info("Spam check failed:", slog.String("check", "ipfilter"), slog.String("reason", "IP is blocklisted"))
+			result.Reasons = append(result.Reasons, SpamReason{Check: "ipfilter", Reason: "IP is blocklisted"})
+			spamChecksFailed.Inc(sub.Id, "ipfilter")
+			result.Verdict = spamReject
+			return result
+		}
+	}
+
+	spamCfg := sub.FormCfg.Spam
+	reject, quarantine := spamCfg.thresholds()
+	for _, check := range fh.spamChecks() {
+		p, err := check.run(sub)
+		if p <= 0 {
+			continue
+		}
+		reason := "check failed"
+		if err != nil {
+			reason = err.Error()
+		}
+		score := p * spamCfg.weight(check.name)
+		sub.logger().Info("Spam check failed:",
+			slog.String("check", check.name),
+			slog.Float64("score", score),
+			slog.String("reason", reason),
+		)
+		spamChecksFailed.Inc(sub.Id, check.name)
+		result.Score += score
+		result.Reasons = append(result.Reasons, SpamReason{Check: check.name, Score: score, Reason: reason})
+	}
+
+	switch {
+	case result.Score >= reject:
+		result.Verdict = spamReject
+	case quarantine > 0 && result.Score >= quarantine:
+		result.Verdict = spamQuarantine
 	}
-	return true
+	return result
 }
@@ -2,6 +2,9 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/joho/godotenv"
@@ -11,12 +14,7 @@ func TestCheck_blocklist(t *testing.T) {
 	c := &Check{}
 	fh := &FormHandler{
 		Config: &Config{
-			Global: struct {
-				Blocklist []string `env:"BLOCKLIST" envSeparator:","`
-				Port      int      `env:"PORT" envDefault:"8080"`
-				BaseUrl   string
-				LogLevel  string
-			}{
+			Global: GlobalConfig{
 				Blocklist: []string{"casino", "website"},
 			},
 		},
@@ -112,6 +110,98 @@ func TestCheck_blocklist(t *testing.T) {
 			expectedPass: false,
 			expectedErr:  errors.New("message contains blocklist term \"website\""),
 		},
+		{
+			name: "Case-insensitive term",
+			submission: FormSubmission{
+				Body: map[string]string{
+					"message": "Visit HTTP://example.com",
+				},
+				FormCfg: FormConfig{
+					Blocklist: []string{"http"},
+					Fields: struct {
+						Name     string
+						Email    string
+						Message  string
+						Honeypot string
+					}{
+						Name:    "name",
+						Email:   "email",
+						Message: "message",
+					},
+				},
+			},
+			expectedPass: false,
+			expectedErr:  errors.New("message contains blocklist term \"http\""),
+		},
+		{
+			name: "Term in name field",
+			submission: FormSubmission{
+				Body: map[string]string{
+					"name":    "Best Cаsino",
+					"message": "hello",
+				},
+				FormCfg: FormConfig{
+					Fields: struct {
+						Name     string
+						Email    string
+						Message  string
+						Honeypot string
+					}{
+						Name:    "name",
+						Email:   "email",
+						Message: "message",
+					},
+				},
+			},
+			expectedPass: false,
+			expectedErr:  errors.New("name contains blocklist term \"casino\""),
+		},
+		{
+			name: "Regex term",
+			submission: FormSubmission{
+				Body: map[string]string{
+					"email": "seo@rank-booster.biz",
+				},
+				FormCfg: FormConfig{
+					Blocklist: []string{`re:\.biz$`},
+					Fields: struct {
+						Name     string
+						Email    string
+						Message  string
+						Honeypot string
+					}{
+						Name:    "name",
+						Email:   "email",
+						Message: "message",
+					},
+				},
+			},
+			expectedPass: false,
+			expectedErr:  errors.New(`email contains blocklist term "\.biz$"`),
+		},
+		{
+			name: "Field-targeted rule",
+			submission: FormSubmission{
+				Body: map[string]string{
+					"company": "SEO Agency",
+				},
+				FormCfg: FormConfig{
+					Rules: []BlockRule{{Pattern: "seo", Match: "word", Fields: []string{"company"}}},
+					Fields: struct {
+						Name     string
+						Email    string
+						Message  string
+						Honeypot string
+					}{
+						Name:    "name",
+						Email:   "email",
+						Message: "message",
+					},
+				},
+			},
+			expectedPass: false,
+			expectedErr:  errors.New("company contains blocklist term \"seo\""),
+		},
 	}
 
 	for _, test := range tests {
@@ -127,6 +217,32 @@ func TestCheck_blocklist(t *testing.T) {
 	}
 }
 
+func TestCheck_blocklistPass(t *testing.T) {
+	c := &Check{}
+	fh := &FormHandler{Config: &Config{}}
+	formCfg := FormConfig{
+		Blocklist: []string{"word:sex"},
+		Rules:     []BlockRule{{Pattern: "agency", Fields: []string{"company"}}},
+	}
+	formCfg.Fields.Name = "name"
+	formCfg.Fields.Message = "message"
+	sub := FormSubmission{
+		Body: map[string]string{
+			"name":    "Agency",
+			"message": "We are in Essex and Middlesex",
+			"company": "Acme",
+		},
+		FormCfg: formCfg,
+	}
+	pass, err := c.blocklist(sub, *fh)
+	if !pass {
+		t.Errorf("Expected %v, got %v", true, pass)
+	}
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
 func TestCheck_honeypot(t *testing.T) {
 	c := &Check{}
 	sub := FormSubmission{
@@ -195,7 +311,7 @@ func TestCheck_turnstile(t *testing.T) {
 		},
 	}
 	expected := true
-	pass, err := c.turnstile(sub)
+	pass, err := c.captcha(sub, FormHandler{})
 	if pass != expected {
 		t.Errorf("Expected %v, got %v", expected, pass)
 	}
@@ -206,7 +322,7 @@ func TestCheck_turnstile(t *testing.T) {
 	// test blank key (true)
 	sub.FormCfg.TurnstileKey = ""
 	expected = true
-	pass, err = c.turnstile(sub)
+	pass, err = c.captcha(sub, FormHandler{})
 	if pass != expected {
 		t.Errorf("Expected %v, got %v", expected, pass)
 	}
@@ -219,7 +335,7 @@ func TestCheck_turnstile(t *testing.T) {
 	sub.Body["cf-turnstile-response"] = keys.Token
 	expected = false
 	expectedErr := errors.New("invalid-input-response")
-	pass, err = c.turnstile(sub)
+	pass, err = c.captcha(sub, FormHandler{})
 	if pass != expected {
 		t.Errorf("Expected %v, got %v", expected, pass)
 	}
@@ -235,12 +351,7 @@ func TestFormHandler_checkSpam(t *testing.T) {
 	}
 	fh := &FormHandler{
 		Config: &Config{
-			Global: struct {
-				Blocklist []string `env:"BLOCKLIST" envSeparator:","`
-				Port      int      `env:"PORT" envDefault:"8080"`
-				BaseUrl   string
-				LogLevel  string
-			}{
+			Global: GlobalConfig{
 				Blocklist: []string{"global", "block"},
 				Port:      8080,
 				BaseUrl:   "http://localhost:8080",
@@ -270,14 +381,14 @@ func TestFormHandler_checkSpam(t *testing.T) {
 		UserIP:    "8.8.8.8",
 	}
 	expected := true
-	pass := fh.checkSpam(sub)
+	pass := fh.checkSpam(sub).Verdict == spamAccept
 	if pass != expected {
 		t.Errorf("Expected %v, got %v", expected, pass)
 	}
 
 	sub.Body["honeypot"] = "not empty"
 	expected = false
-	pass = fh.checkSpam(sub)
+	pass = fh.checkSpam(sub).Verdict == spamAccept
 	if pass != expected {
 		t.Errorf("Honeypot not empty: Expected %v, got %v", expected, pass)
 	}
@@ -285,7 +396,7 @@ func TestFormHandler_checkSpam(t *testing.T) {
 	sub.Body["honeypot"] = ""
 	sub.Body["message"] = "This is a spam message"
 	expected = false
-	pass = fh.checkSpam(sub)
+	pass = fh.checkSpam(sub).Verdict == spamAccept
 	if pass != expected {
 		t.Errorf("Honeypot empty: Expected %v, got %v", expected, pass)
 	}
@@ -293,8 +404,97 @@ func TestFormHandler_checkSpam(t *testing.T) {
 	sub.Body["message"] = "This is a test message"
 	sub.FormCfg.TurnstileKey = keys.Secret.Fail
 	expected = false
-	pass = fh.checkSpam(sub)
+	pass = fh.checkSpam(sub).Verdict == spamAccept
 	if pass != expected {
 		t.Errorf("Turnstile: Expected %v, got %v", expected, pass)
 	}
 }
+
+func TestFormHandler_checkSpamScore(t *testing.T) {
+	fh := &FormHandler{Config: &Config{}}
+	formCfg := FormConfig{
+		Blocklist: []string{"casino"},
+		Spam: SpamConfig{
+			Weights:         map[string]float64{"blocklist": 0.5, "honeypot": 2},
+			RejectScore:     2,
+			QuarantineScore: 0.5,
+		},
+	}
+	formCfg.Fields.Message = "message"
+	formCfg.Fields.Honeypot = "honeypot"
+
+	tests := []struct {
+		name     string
+		body     map[string]string
+		score    float64
+		verdict  spamVerdict
+		failures []string
+	}{
+		{"Ham", map[string]string{"message": "hello"}, 0, spamAccept, nil},
+		{"Blocklist quarantines", map[string]string{"message": "casino"}, 0.5, spamQuarantine, []string{"blocklist"}},
+		{"Honeypot rejects", map[string]string{"message": "hello", "honeypot": "x"}, 2, spamReject, []string{"honeypot"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := fh.checkSpam(FormSubmission{Body: test.body, FormCfg: formCfg})
+			if result.Score != test.score {
+				t.Errorf("Expected score %v, got %v", test.score, result.Score)
+			}
+			if result.Verdict != test.verdict {
+				t.Errorf("Expected verdict %v, got %v", test.verdict, result.Verdict)
+			}
+			if len(result.Reasons) != len(test.failures) {
+				t.Fatalf("Expected reasons %v, got %v", test.failures, result.Reasons)
+			}
+			for i, check := range test.failures {
+				if result.Reasons[i].Check != check {
+					t.Errorf("Expected reason %v, got %v", check, result.Reasons[i].Check)
+				}
+			}
+		})
+	}
+
+	// without thresholds any failing check rejects
+	formCfg.Spam = SpamConfig{}
+	result := fh.checkSpam(FormSubmission{Body: map[string]string{"message": "casino"}, FormCfg: formCfg})
+	if result.Verdict != spamReject {
+		t.Errorf("Expected verdict %v, got %v", spamReject, result.Verdict)
+	}
+
+	// a negative weight lowers the score of the checks before it
+	formCfg.Spam = SpamConfig{Weights: map[string]float64{"honeypot": 2, "blocklist": -1.5}}
+	result = fh.checkSpam(FormSubmission{Body: map[string]string{"message": "casino", "honeypot": "x"}, FormCfg: formCfg})
+	if result.Score != 0.5 || result.Verdict != spamAccept {
+		t.Errorf("Expected score %v and verdict %v, got %v and %v", 0.5, spamAccept, result.Score, result.Verdict)
+	}
+}
+
+func TestCheck_captcha(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		success := r.PostForm.Get("response") == "good"
+		fmt.Fprintf(w, `{"success": %v}`, success)
+	}))
+	defer srv.Close()
+
+	c := &Check{}
+	fh := &FormHandler{Config: &Config{}}
+	for _, provider := range []string{"hcaptcha", "recaptcha"} {
+		sub := FormSubmission{
+			FormCfg: FormConfig{Captcha: CaptchaConfig{Provider: provider, Secret: "secret", Endpoint: srv.URL}},
+			Body:    map[string]string{captchaFields[provider]: "good"},
+		}
+		if pass, err := c.captcha(sub, *fh); !pass {
+			t.Errorf("%s: Expected pass, got %v", provider, err)
+		}
+		sub.Body[captchaFields[provider]] = "bad"
+		if pass, _ := c.captcha(sub, *fh); pass {
+			t.Errorf("%s: Expected fail, got pass", provider)
+		}
+	}
+
+	sub := FormSubmission{FormCfg: FormConfig{Captcha: CaptchaConfig{Provider: "unknown"}}}
+	if pass, err := c.captcha(sub, *fh); pass || err == nil {
+		t.Errorf("Expected unknown provider to fail with an error, got %v %v", pass, err)
+	}
+}
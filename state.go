@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// how long a state token can be exchanged for the submitted values
+const stateTokenExpires = time.Hour
+
+// longer tokens are left out of redirects, browsers and servers limit URL length
+const maxStateTokenLength = 4096
+
+var errInvalidStateToken = errors.New("invalid state token")
+
+type submissionState struct {
+	Form    string   `json:"form"`
+	Expires int64    `json:"expires"`
+	Fields  FormBody `json:"fields"`
+}
+
+// stateCipher encrypts state tokens, which carry the visitor's input
+func (fh *FormHandler) stateCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256(append([]byte("state\x00"), fh.Config.signingKey()...))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// stateFields returns the submitted values worth giving back to the visitor,
+// without the honeypot and spam protection tokens
+func stateFields(sub FormSubmission) FormBody {
+	skip := map[string]bool{
+		sub.FormCfg.Fields.Honeypot:                 true,
+		sub.FormCfg.FillTime.field():                true,
+		sub.FormCfg.Dedup.field():                   true,
+		captchaFields["turnstile"]:                  true,
+		captchaFields[sub.FormCfg.Captcha.Provider]: true,
+	}
+	fields := make(FormBody, len(sub.Raw))
+	for k, v := range sub.Raw {
+		if !skip[k] {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// stateToken encrypts and signs the submitted values so the form page can
+// fill them in again after a failed submission
+func (fh *FormHandler) stateToken(sub FormSubmission, now time.Time) (string, error) {
+	data, err := json.Marshal(submissionState{
+		Form:    sub.Id,
+		Expires: now.Add(stateTokenExpires).Unix(),
+		Fields:  stateFields(sub),
+	})
+	if err != nil {
+		return "", err
+	}
+	aead, err := fh.stateCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, data, []byte(sub.Id))), nil
+}
+
+// parseStateToken returns the submitted values of a valid token for the form
+func (fh *FormHandler) parseStateToken(token string, form string, now time.Time) (FormBody, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errInvalidStateToken
+	}
+	aead, err := fh.stateCipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errInvalidStateToken
+	}
+	data, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(form))
+	if err != nil {
+		return nil, errInvalidStateToken
+	}
+	var state submissionState
+	if err := json.Unmarshal(data, &state); err != nil || state.Form != form {
+		return nil, errInvalidStateToken
+	}
+	if now.Unix() > state.Expires {
+		return nil, errors.New("state token expired")
+	}
+	return state.Fields, nil
+}
+
+// target returns where a failed submission is redirected, "" for none.
+// Spam and Invalid fall back to Error.
+func (cfg RedirectConfig) target(kind submitError) string {
+	switch {
+	case kind == errUnknownForm:
+		return ""
+	case kind == errSpam && cfg.Spam != "":
+		return cfg.Spam
+	case (kind == errBadRequest || kind == errTooLarge) && cfg.Invalid != "":
+		return cfg.Invalid
+	}
+	return cfg.Error
+}
+
+// errorRedirect adds the error code and state token to a redirect target
+func (fh *FormHandler) errorRedirect(target string, sub FormSubmission, kind submitError) string {
+	cfg := sub.FormCfg.Redirects
+	if !cfg.Params && !cfg.State {
+		return target
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		slog.Error("Invalid redirect URL:", slog.String("url", target), slog.Any("error", err))
+		return target
+	}
+	query := u.Query()
+	if cfg.Params {
+		query.Set("error", string(kind))
+	}
+	if cfg.State && sub.Raw != nil {
+		token, err := fh.stateToken(sub, time.Now())
+		switch {
+		case err != nil:
+			sub.logger().Error("Failed to create state token:", slog.Any("error", err))
+		case len(token) > maxStateTokenLength:
+			sub.logger().Info("State token too long for a redirect:", slog.Int("length", len(token)))
+		default:
+			query.Set("state", token)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// handleState exchanges a state token from an error redirect for the
+// submitted values, e.g. GET /contact/state?token=...
+func (fh *FormHandler) handleState(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, exists := fh.Config.Forms[id]; !exists {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "no-store")
+	fields, err := fh.parseStateToken(r.URL.Query().Get("token"), id, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]FormBody{"fields": fields})
+}
@@ -0,0 +1,59 @@
+// fohago form state
+//
+// Add data-fohago-state to a form with the URL of the state endpoint and set
+// redirects.state for the form:
+//
+//   <form method="post" action="https://fohago.example.com/contact"
+//         data-fohago-state="https://fohago.example.com/contact/state">
+//   <script src="https://fohago.example.com/state.js" defer></script>
+//
+// After a failed submission fohago redirects back with a state token, which
+// the widget exchanges for the submitted values to fill the form in again.
+// With redirects.params the error code is set as data-fohago-error on the form.
+(function () {
+  "use strict";
+
+  async function restore(form, params) {
+    const error = params.get("error");
+    if (error) {
+      form.dataset.fohagoError = error;
+    }
+    const token = params.get("state");
+    if (!token) {
+      return;
+    }
+    try {
+      const url = new URL(form.dataset.fohagoState, location.href);
+      url.searchParams.set("token", token);
+      const resp = await fetch(url, { cache: "no-store" });
+      if (!resp.ok) {
+        return;
+      }
+      const data = await resp.json();
+      for (const [name, value] of Object.entries(data.fields)) {
+        const field = form.elements.namedItem(name);
+        if (!field || field.type === "hidden" || field.type === "file") {
+          continue;
+        }
+        if (field.type === "checkbox" || field.type === "radio") {
+          field.checked = field.value === value;
+        } else {
+          field.value = value;
+        }
+      }
+    } catch (err) {
+      console.error("fohago: could not restore form state", err);
+    }
+  }
+
+  function init() {
+    const params = new URLSearchParams(location.search);
+    document.querySelectorAll("form[data-fohago-state]").forEach((form) => restore(form, params));
+  }
+
+  if (document.readyState === "loading") {
+    document.addEventListener("DOMContentLoaded", init);
+  } else {
+    init();
+  }
+})();
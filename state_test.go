@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestFormHandler_stateToken(t *testing.T) {
+	conf := &Config{}
+	conf.Global.SecretKey = "secret"
+	fh := &FormHandler{Config: conf}
+	sub := FormSubmission{
+		Id:  "contact",
+		Raw: FormBody{"name": "Zoë", "message": "<b>hi</b>", "website": "", "fohago-token": "abc", "cf-turnstile-response": "xyz"},
+	}
+	sub.FormCfg.Fields.Honeypot = "website"
+	now := time.Now()
+
+	token, err := fh.stateToken(sub, now)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	fields, err := fh.parseStateToken(token, "contact", now)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := FormBody{"name": "Zoë", "message": "<b>hi</b>"}
+	if len(fields) != len(expected) || fields["name"] != expected["name"] || fields["message"] != expected["message"] {
+		t.Errorf("Expected %v, got %v", expected, fields)
+	}
+
+	if _, err := fh.parseStateToken(token, "other", now); err != errInvalidStateToken {
+		t.Errorf("Expected %v for another form, got %v", errInvalidStateToken, err)
+	}
+	if _, err := fh.parseStateToken(token, "contact", now.Add(2*time.Hour)); err == nil {
+		t.Error("Expected an error for an expired token")
+	}
+	if _, err := fh.parseStateToken(token[:len(token)-2]+"AA", "contact", now); err != errInvalidStateToken {
+		t.Errorf("Expected %v for a tampered token, got %v", errInvalidStateToken, err)
+	}
+}
+
+func TestRedirectConfig_target(t *testing.T) {
+	cfg := RedirectConfig{Error: "/error", Spam: "/spam"}
+	tests := map[submitError]string{
+		errUnknownForm:    "",
+		errSpam:           "/spam",
+		errBadRequest:     "/error",
+		errDeliveryFailed: "/error",
+	}
+	for kind, expected := range tests {
+		if target := cfg.target(kind); target != expected {
+			t.Errorf("%v: Expected %q, got %q", kind, expected, target)
+		}
+	}
+}
+
+func TestFormHandler_errorRedirectState(t *testing.T) {
+	fh, _ := newFormTestHandler(t)
+	formCfg := fh.Config.Forms["contact"]
+	formCfg.Redirects = RedirectConfig{Spam: "https://example.com/contact.html?lang=en", Params: true, State: true}
+	fh.Config.Forms["contact"] = formCfg
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /{id}", fh.handleFormSubmission)
+	mux.HandleFunc("GET /{id}/state", fh.handleState)
+
+	w := postForm(mux, "/contact", "message=hello&website=spam")
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected %v, got %v", http.StatusFound, w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	query := location.Query()
+	if query.Get("lang") != "en" || query.Get("error") != "spam" || query.Get("state") == "" {
+		t.Errorf("Expected lang, error and state parameters, got %v", location)
+	}
+
+	r := httptest.NewRequest("GET", "/contact/state?token="+url.QueryEscape(query.Get("state")), nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected %v, got %v", http.StatusOK, rec.Code)
+	}
+	if body := rec.Body.String(); body != "{\"fields\":{\"message\":\"hello\"}}\n" {
+		t.Errorf("Expected the message without the honeypot, got %v", body)
+	}
+}
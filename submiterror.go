@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// submitError is the kind of failure of a form submission
+type submitError string
+
+func (kind submitError) Error() string {
+	return string(kind)
+}
+
+const (
+	errUnknownForm    submitError = "unknown-form"
+	errBadRequest     submitError = "bad-request"
+	errTooLarge       submitError = "too-large"
+	errRateLimited    submitError = "rate-limited"
+	errSpam           submitError = "spam"
+	errDeliveryFailed submitError = "delivery-failed"
+	errInternal       submitError = "internal-error"
+)
+
+// status returns the HTTP status code for a kind of failure
+func (kind submitError) status() int {
+	switch kind {
+	case errUnknownForm:
+		return http.StatusNotFound
+	case errBadRequest, errSpam:
+		return http.StatusBadRequest
+	case errTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case errRateLimited:
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+// SubmissionError is returned when a submission fails. Use errors.Is to
+// check for the kind of failure.
+type SubmissionError struct {
+	Kind submitError
+	Err  error
+	// RetryAfter is set for rate limited submissions
+	RetryAfter time.Duration
+}
+
+func (e *SubmissionError) Error() string {
+	if e.Err == nil {
+		return string(e.Kind)
+	}
+	return string(e.Kind) + ": " + e.Err.Error()
+}
+
+func (e *SubmissionError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *SubmissionError) Unwrap() error {
+	return e.Err
+}
+
+func submissionError(kind submitError, err error) *SubmissionError {
+	return &SubmissionError{Kind: kind, Err: err}
+}
+
+// failureKind returns the kind of a submission error, errInternal if unknown
+func failureKind(err error) submitError {
+	var subErr *SubmissionError
+	if errors.As(err, &subErr) {
+		return subErr.Kind
+	}
+	return errInternal
+}
+
+// logSubmission logs the outcome of a submission, failures of the server
+// at Error level
+func logSubmission(sub FormSubmission, outcome string, err error) {
+	logger := sub.logger().With(slog.String("outcome", outcome))
+	switch {
+	case err == nil && outcome == outcomeQuarantined:
+		logger.Info("Submission quarantined:")
+	case err == nil && outcome == outcomeDuplicate:
+		logger.Info("Duplicate submission dropped:")
+	case err == nil:
+		logger.Info("Submission accepted:")
+	case failureKind(err).status() >= http.StatusInternalServerError:
+		logger.Error("Submission failed:", slog.Any("error", err))
+	default:
+		logger.Info("Submission rejected:", slog.Any("error", err))
+	}
+}
+
+// writeSubmissionError responds to a failed submission, with the form's
+// error redirect if it has one or a plain status otherwise
+func (fh *FormHandler) writeSubmissionError(w http.ResponseWriter, r *http.Request, sub FormSubmission, err error) {
+	kind := failureKind(err)
+	status := kind.status()
+	if target := sub.FormCfg.Redirects.target(kind); target != "" {
+		http.Redirect(w, r, fh.errorRedirect(target, sub, kind), http.StatusFound)
+		return
+	}
+	var subErr *SubmissionError
+	if errors.As(err, &subErr) && subErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(subErr.RetryAfter.Seconds()))))
+	}
+	message := http.StatusText(status)
+	if kind == errSpam {
+		message = "Spam detected"
+	}
+	http.Error(w, message, status)
+}
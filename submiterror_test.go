@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogSubmission(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	tests := []struct {
+		outcome  string
+		expected string
+	}{
+		{outcomeAccepted, "Submission accepted:"},
+		{outcomeQuarantined, "Submission quarantined:"},
+		{outcomeDuplicate, "Duplicate submission dropped:"},
+	}
+	for _, test := range tests {
+		buf.Reset()
+		logSubmission(FormSubmission{Id: "contact"}, test.outcome, nil)
+		if !strings.Contains(buf.String(), test.expected) {
+			t.Errorf("Expected %v, got %v", test.expected, buf.String())
+		}
+	}
+}
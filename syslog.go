@@ -0,0 +1,93 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"net/url"
+	"strings"
+)
+
+// newSyslogHandler logs to the local syslog daemon for "syslog", or to a
+// remote one for "syslog://host:514" (UDP) and "syslog+tcp://host:514".
+// Records are sent with the severity of their level.
+func newSyslogHandler(output string, format string, level slog.Level) (slog.Handler, io.Closer, error) {
+	var network, addr string
+	if output != "syslog" {
+		u, err := url.Parse(output)
+		if err != nil {
+			return nil, nil, err
+		}
+		network, addr = "udp", u.Host
+		if strings.HasSuffix(u.Scheme, "+tcp") {
+			network = "tcp"
+		}
+	}
+	w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_DAEMON, "fohago")
+	if err != nil {
+		return nil, nil, err
+	}
+	// syslog adds its own timestamp
+	dropTime := func(groups []string, a slog.Attr) slog.Attr {
+		if a.Key == slog.TimeKey && len(groups) == 0 {
+			return slog.Attr{}
+		}
+		return a
+	}
+	severity := func(write func(string) error) slog.Handler {
+		return newFormatHandler(syslogWriter(write), format, level, dropTime)
+	}
+	h := syslogHandler{
+		debug: severity(w.Debug),
+		info:  severity(w.Info),
+		warn:  severity(w.Warning),
+		err:   severity(w.Err),
+	}
+	return h, w, nil
+}
+
+// syslogWriter writes each log line as a syslog message
+type syslogWriter func(string) error
+
+func (w syslogWriter) Write(p []byte) (int, error) {
+	if err := w(strings.TrimSuffix(string(p), "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// syslogHandler passes records to the handler for their severity
+type syslogHandler struct {
+	debug, info, warn, err slog.Handler
+}
+
+func (h syslogHandler) forLevel(level slog.Level) slog.Handler {
+	switch {
+	case level >= slog.LevelError:
+		return h.err
+	case level >= slog.LevelWarn:
+		return h.warn
+	case level >= slog.LevelInfo:
+		return h.info
+	}
+	return h.debug
+}
+
+func (h syslogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.forLevel(level).Enabled(ctx, level)
+}
+
+func (h syslogHandler) Handle(ctx context.Context, record slog.Record) error {
+	return h.forLevel(record.Level).Handle(ctx, record)
+}
+
+func (h syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return syslogHandler{h.debug.WithAttrs(attrs), h.info.WithAttrs(attrs), h.warn.WithAttrs(attrs), h.err.WithAttrs(attrs)}
+}
+
+func (h syslogHandler) WithGroup(name string) slog.Handler {
+	return syslogHandler{h.debug.WithGroup(name), h.info.WithGroup(name), h.warn.WithGroup(name), h.err.WithGroup(name)}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// supported minimum TLS versions, older ones are insecure
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certReloader serves a certificate that is reloaded when its files
+// change or on Reload, so renewals don't need a restart
+type certReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTime  time.Time
+	checked  time.Time
+}
+
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := cr.load(time.Now()); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// latestModTime returns when the certificate or key last changed
+func (cr *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{cr.certFile, cr.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (cr *certReloader) load(now time.Time) error {
+	cr.checked = now
+	modTime, err := cr.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+	cr.cert = &cert
+	cr.modTime = modTime
+	return nil
+}
+
+// Reload reads the certificate and key again. On error the current
+// certificate is kept.
+func (cr *certReloader) Reload() error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	return cr.reload()
+}
+
+func (cr *certReloader) reload() error {
+	if err := cr.load(time.Now()); err != nil {
+		slog.Error("Could not reload TLS certificate:", slog.String("cert", cr.certFile), slog.Any("error", err))
+		return err
+	}
+	slog.Info("Reloaded TLS certificate:", slog.String("cert", cr.certFile))
+	return nil
+}
+
+// GetCertificate returns the current certificate, reloading it if the
+// files changed since they were last checked
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if now := time.Now(); now.Sub(cr.checked) >= listReloadInterval {
+		cr.checked = now
+		if modTime, err := cr.latestModTime(); err == nil && !modTime.Equal(cr.modTime) {
+			cr.reload()
+		}
+	}
+	return cr.cert, nil
+}
+
+// tlsConfig returns the server TLS config, or nil if TLS is not enabled
+func tlsConfig(conf *Config) (*tls.Config, *certReloader, error) {
+	cfg := conf.Global.TLS
+	if cfg.CertFile == "" && cfg.KeyFile == "" {
+		return nil, nil, nil
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, nil, errors.New("TLS needs both certFile and keyFile")
+	}
+	minVersion := uint16(tls.VersionTLS12)
+	if cfg.MinVersion != "" {
+		version, ok := tlsVersions[cfg.MinVersion]
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported TLS version %q, use 1.2 or 1.3", cfg.MinVersion)
+		}
+		minVersion = version
+	}
+	reloader, err := newCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConf := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if cfg.ClientCA != "" {
+		pem, err := os.ReadFile(cfg.ClientCA)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("no certificates in %s", cfg.ClientCA)
+		}
+		// only the admin routes require a client certificate
+		tlsConf.ClientAuth = tls.VerifyClientCertIfGiven
+		tlsConf.ClientCAs = pool
+	}
+	return tlsConf, reloader, nil
+}
+
+// hasClientCert reports whether the request came with a verified client certificate
+func hasClientCert(r *http.Request) bool {
+	return r.TLS != nil && len(r.TLS.VerifiedChains) > 0
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL on the HTTPS port
+func redirectToHTTPS(httpsAddr net.Addr) http.Handler {
+	port := ""
+	if addr, ok := httpsAddr.(*net.TCPAddr); ok && addr.Port != 443 {
+		port = ":" + strconv.Itoa(addr.Port)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if host == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "https://"+host+port+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
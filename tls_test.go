@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate and key and returns their paths
+func writeTestCert(t *testing.T, dir string, name string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+	return certFile, keyFile
+}
+
+func leafName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	conf := &Config{}
+	if tlsConf, _, err := tlsConfig(conf); tlsConf != nil || err != nil {
+		t.Errorf("Expected TLS to be disabled, got %v %v", tlsConf, err)
+	}
+
+	conf.Global.TLS.CertFile, conf.Global.TLS.KeyFile = writeTestCert(t, dir, "old.example")
+	conf.Global.TLS.MinVersion = "1.3"
+	tlsConf, reloader, err := tlsConfig(conf)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if tlsConf.MinVersion != tls.VersionTLS13 {
+		t.Errorf("Expected TLS 1.3, got %x", tlsConf.MinVersion)
+	}
+	cert, _ := tlsConf.GetCertificate(nil)
+	if name := leafName(t, cert); name != "old.example" {
+		t.Errorf("Expected old.example, got %v", name)
+	}
+
+	// a renewed certificate is picked up on the next check
+	writeTestCert(t, dir, "new.example")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(conf.Global.TLS.CertFile, later, later)
+	reloader.checked = time.Time{}
+	cert, _ = tlsConf.GetCertificate(nil)
+	if name := leafName(t, cert); name != "new.example" {
+		t.Errorf("Expected new.example after the files changed, got %v", name)
+	}
+
+	// a broken file keeps the current certificate
+	os.WriteFile(conf.Global.TLS.KeyFile, []byte("broken"), 0o600)
+	if err := reloader.Reload(); err == nil {
+		t.Error("Expected an error reloading a broken key")
+	}
+	cert, _ = tlsConf.GetCertificate(nil)
+	if name := leafName(t, cert); name != "new.example" {
+		t.Errorf("Expected new.example to be kept, got %v", name)
+	}
+
+	for _, version := range []string{"1.0", "1.1", "2.0"} {
+		conf.Global.TLS.MinVersion = version
+		if _, _, err := tlsConfig(conf); err == nil {
+			t.Errorf("Expected an error for TLS version %v", version)
+		}
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		port     int
+		expected string
+	}{
+		{443, "https://forms.example.com/contact?a=1"},
+		{8443, "https://forms.example.com:8443/contact?a=1"},
+	}
+	for _, test := range tests {
+		handler := redirectToHTTPS(&net.TCPAddr{Port: test.port})
+		r := httptest.NewRequest("POST", "http://forms.example.com:80/contact?a=1", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusMovedPermanently {
+			t.Errorf("Expected %v, got %v", http.StatusMovedPermanently, w.Code)
+		}
+		if location := w.Header().Get("Location"); location != test.expected {
+			t.Errorf("Expected %v, got %v", test.expected, location)
+		}
+	}
+}
+
+func TestFormHandler_requireAdminClientCert(t *testing.T) {
+	fh, mux := newAdminTestHandler(t)
+	fh.Config.Global.TLS.ClientCA = "ca.pem"
+
+	if w := adminRequest(mux, "GET", "/admin/quarantine/contact", "admin", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected %v without a client certificate, got %v", http.StatusForbidden, w.Code)
+	}
+
+	r := httptest.NewRequest("GET", "/admin/quarantine/contact", nil)
+	r.Header.Set("Authorization", "Bearer admin")
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected %v with a client certificate, got %v", http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/lkhrs/fohago/antispam"
+)
+
+const defaultTokenField = "fohago-token"
+
+func (cfg FillTimeConfig) field() string {
+	if cfg.Field == "" {
+		return defaultTokenField
+	}
+	return cfg.Field
+}
+
+func (fh *FormHandler) formToken() antispam.FormToken {
+	return antispam.FormToken{
+		Key:    fh.Config.signingKey(),
+		Replay: fh.Replay,
+	}
+}
+
+// handleToken issues a signed timestamp token for a form's fill-time check
+func (fh *FormHandler) handleToken(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	formCfg, exists := fh.Config.Forms[id]
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+	token, err := fh.formToken().Issue(id, time.Now())
+	if err != nil {
+		slog.Error("Failed to issue form token:", slog.Any("error", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"field": formCfg.FillTime.field(),
+		"token": token,
+	})
+}
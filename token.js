@@ -0,0 +1,40 @@
+// fohago form token
+//
+// Add data-fohago-token to a form with the URL of the token endpoint:
+//
+//   <form method="post" action="https://fohago.example.com/contact"
+//         data-fohago-token="https://fohago.example.com/contact/token">
+//   <script src="https://fohago.example.com/token.js" defer></script>
+//
+// The token records when the page was loaded, so fohago can reject forms
+// that are submitted faster than a person could fill them in.
+(function () {
+  "use strict";
+
+  async function protect(form) {
+    try {
+      const resp = await fetch(form.dataset.fohagoToken, { cache: "no-store" });
+      const data = await resp.json();
+      let input = form.querySelector("input[name='" + data.field + "']");
+      if (!input) {
+        input = document.createElement("input");
+        input.type = "hidden";
+        input.name = data.field;
+        form.appendChild(input);
+      }
+      input.value = data.token;
+    } catch (err) {
+      console.error("fohago: could not fetch form token", err);
+    }
+  }
+
+  function init() {
+    document.querySelectorAll("form[data-fohago-token]").forEach(protect);
+  }
+
+  if (document.readyState === "loading") {
+    document.addEventListener("DOMContentLoaded", init);
+  } else {
+    init();
+  }
+})();
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFormHandler_handleToken(t *testing.T) {
+	conf := &Config{Forms: map[string]FormConfig{
+		"contact": {FillTime: FillTimeConfig{Min: time.Hour}},
+		"quote":   {FillTime: FillTimeConfig{Min: time.Millisecond, Field: "ts"}},
+	}}
+	conf.Global.SecretKey = "secret"
+	fh, err := NewFormHandler(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{id}/token", fh.handleToken)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/unknown/token", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected %v, got %v", http.StatusNotFound, w.Code)
+	}
+
+	issue := func(id string) map[string]string {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/"+id+"/token", nil))
+		var data map[string]string
+		if err := json.NewDecoder(w.Body).Decode(&data); err != nil {
+			t.Fatalf("Failed to decode token: %v", err)
+		}
+		return data
+	}
+	c := &Check{}
+
+	data := issue("contact")
+	if data["field"] != defaultTokenField {
+		t.Errorf("Expected field %v, got %v", defaultTokenField, data["field"])
+	}
+	sub := FormSubmission{Id: "contact", FormCfg: conf.Forms["contact"], Body: FormBody{data["field"]: data["token"]}}
+	if pass, _ := c.fillTime(sub, *fh); pass {
+		t.Errorf("Expected instant submission to fail")
+	}
+
+	data = issue("quote")
+	if data["field"] != "ts" {
+		t.Errorf("Expected field ts, got %v", data["field"])
+	}
+	time.Sleep(5 * time.Millisecond)
+	sub = FormSubmission{Id: "quote", FormCfg: conf.Forms["quote"], Body: FormBody{"ts": data["token"]}}
+	if pass, err := c.fillTime(sub, *fh); !pass {
+		t.Errorf("Expected pass, got %v", err)
+	}
+	if pass, _ := c.fillTime(sub, *fh); pass {
+		t.Errorf("Expected reused token to fail")
+	}
+
+	// tokens are bound to their form
+	sub.Id = "contact"
+	sub.FormCfg = conf.Forms["contact"]
+	if pass, _ := c.fillTime(sub, *fh); pass {
+		t.Errorf("Expected token from another form to fail")
+	}
+
+	// disabled without limits
+	sub.FormCfg = FormConfig{}
+	if pass, err := c.fillTime(sub, *fh); !pass {
+		t.Errorf("Expected pass without limits, got %v", err)
+	}
+}